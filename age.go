@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxAge limits age arguments, so birth bounds fit int32.
+const MaxAge = 100
+
+// NowTs is a time ages are computed against: CurTs of data set if it is
+// known, wall clock otherwise.
+func NowTs() int32 {
+	if CurTs != 0 {
+		return CurTs
+	}
+	return int32(time.Now().Unix())
+}
+
+// ageBirthMax returns latest birth of account being at least age years old.
+func ageBirthMax(age int) int32 {
+	ts := time.Unix(int64(NowTs()), 0).UTC().AddDate(-age, 0, 0).Unix()
+	if ts < math.MinInt32 {
+		return math.MinInt32
+	}
+	return int32(ts)
+}
+
+// AgeBirthRange returns inclusive birth range of accounts with
+// from <= age <= to. Negative to means no upper bound.
+func AgeBirthRange(from, to int) (int32, int32) {
+	lo, hi := int32(math.MinInt32), ageBirthMax(from)
+	if to >= 0 {
+		lo = ageBirthMax(to+1) + 1
+	}
+	return lo, hi
+}
+
+// addAgeArg applies age_gt, age_lt and age_eq predicates over BirthRange.
+// It returns false for unknown key.
+func (q *filterQuery) addAgeArg(skey, sval string) bool {
+	switch skey {
+	case "age_gt", "age_lt", "age_eq":
+	default:
+		return false
+	}
+	q.outFields.Birth = true
+	age, err := strconv.Atoi(sval)
+	if err != nil || age < 0 || age > MaxAge {
+		logf("%s incorrect", skey)
+		q.correct = false
+		return true
+	}
+	var lo, hi int32
+	switch skey {
+	case "age_gt":
+		lo, hi = AgeBirthRange(age+1, -1)
+	case "age_lt":
+		if age == 0 {
+			q.emptyRes = true
+			return true
+		}
+		lo, hi = AgeBirthRange(0, age-1)
+	case "age_eq":
+		lo, hi = AgeBirthRange(age, age)
+	}
+	q.addRange(&BirthRange, lo, hi)
+	return true
+}
+
+// AgeRanges are default /group/ age buckets.
+var AgeRanges []int
+
+// ParseAgeRanges parses ascending list of ages starting age groups, e.g.
+// "18,25,35" gives groups 0-17, 18-24, 25-34 and 35+.
+func ParseAgeRanges(s string) ([]int, bool) {
+	var ranges []int
+	for _, f := range strings.Split(s, ",") {
+		age, err := strconv.Atoi(f)
+		if err != nil || age <= 0 || age > MaxAge {
+			return nil, false
+		}
+		ranges = append(ranges, age)
+	}
+	if !sort.IntsAreSorted(ranges) {
+		return nil, false
+	}
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i] == ranges[i-1] {
+			return nil, false
+		}
+	}
+	return ranges, true
+}
+
+// AgeGroup returns label and age bounds of i-th group of ranges.
+func AgeGroup(ranges []int, i int) (string, int, int) {
+	from, to := 0, -1
+	if i > 0 {
+		from = ranges[i-1]
+	}
+	if i < len(ranges) {
+		to = ranges[i] - 1
+	}
+	if to < 0 {
+		return strconv.Itoa(from) + "+", from, to
+	}
+	return strconv.Itoa(from) + "-" + strconv.Itoa(to), from, to
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// calendarAge is age in full years of person born at birth by the time now.
+func calendarAge(birth, now int32) int {
+	b := time.Unix(int64(birth), 0).UTC()
+	n := time.Unix(int64(now), 0).UTC()
+	age := n.Year() - b.Year()
+	if n.Month() < b.Month() || n.Month() == b.Month() &&
+		(n.Day() < b.Day() || n.Day() == b.Day() && n.Sub(n.Truncate(24*time.Hour)) < b.Sub(b.Truncate(24*time.Hour))) {
+		age--
+	}
+	return age
+}
+
+func withCurTs(ts int32, f func()) {
+	saved := CurTs
+	CurTs = ts
+	defer func() { CurTs = saved }()
+	f()
+}
+
+func TestParseAgeRanges(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want []int
+	}{
+		{"18,25,35", []int{18, 25, 35}},
+		{"30", []int{30}},
+		{"1,100", []int{1, 100}},
+	} {
+		got, ok := ParseAgeRanges(c.s)
+		require.True(t, ok, c.s)
+		require.Equal(t, c.want, got, c.s)
+	}
+	for _, s := range []string{"", "18,", "18,,25", "25,18", "18,18", "0,18", "-5", "18,101", "abc", "18;25"} {
+		_, ok := ParseAgeRanges(s)
+		require.False(t, ok, s)
+	}
+}
+
+func TestAgeGroup(t *testing.T) {
+	ranges := []int{18, 25, 35}
+	type group struct {
+		label    string
+		from, to int
+	}
+	want := []group{{"0-17", 0, 17}, {"18-24", 18, 24}, {"25-34", 25, 34}, {"35+", 35, -1}}
+	for i, w := range want {
+		label, from, to := AgeGroup(ranges, i)
+		require.Equal(t, w, group{label, from, to}, "group %d", i)
+	}
+	label, from, to := AgeGroup(nil, 0)
+	require.Equal(t, "0+", label)
+	require.Equal(t, 0, from)
+	require.Equal(t, -1, to)
+}
+
+func TestAgeBirthRange(t *testing.T) {
+	clocks := []int32{
+		1545834028,
+		int32(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		int32(time.Date(2019, 2, 28, 23, 59, 59, 0, time.UTC).Unix()),
+		int32(time.Date(2038, 1, 1, 0, 0, 0, 0, time.UTC).Unix()),
+	}
+	for _, now := range clocks {
+		withCurTs(now, func() {
+			require.Equal(t, now, NowTs())
+			for _, r := range [][2]int{{0, 0}, {0, 17}, {18, 24}, {30, 30}, {35, -1}, {65, -1}, {MaxAge, MaxAge}} {
+				lo, hi := AgeBirthRange(r[0], r[1])
+				require.True(t, lo <= hi, "%d %v", now, r)
+				require.True(t, calendarAge(hi, now) >= r[0], "%d %v: hi %d", now, r, hi)
+				require.Equal(t, r[0]-1, calendarAge(hi+1, now), "%d %v: hi %d", now, r, hi)
+				if r[1] < 0 {
+					require.Equal(t, int32(math.MinInt32), lo, "%d %v", now, r)
+					continue
+				}
+				require.Equal(t, r[1], calendarAge(lo, now), "%d %v: lo %d", now, r, lo)
+				require.Equal(t, r[1]+1, calendarAge(lo-1, now), "%d %v: lo %d", now, r, lo)
+			}
+			// births on leap day
+			leap := int32(time.Date(2016, 2, 29, 12, 0, 0, 0, time.UTC).Unix())
+			if leap <= now {
+				age := calendarAge(leap, now)
+				lo, hi := AgeBirthRange(age, age)
+				require.True(t, lo <= leap && leap <= hi, "%d: age %d", now, age)
+			}
+		})
+	}
+
+	withCurTs(0, func() {
+		require.InDelta(t, time.Now().Unix(), int64(NowTs()), 2)
+	})
+}
+
+func TestAgeFilter(t *testing.T) {
+	loadFixture(t)
+
+	age := func(acc *Account) int { return calendarAge(acc.Birth, CurTs) }
+	for _, n := range []int{0, 1, 17, 18, 25, 30, 38, 47, 48, MaxAge} {
+		n := n
+		for _, c := range []struct {
+			key   string
+			match func(a int) bool
+		}{
+			{"age_gt", func(a int) bool { return a > n }},
+			{"age_lt", func(a int) bool { return a < n }},
+			{"age_eq", func(a int) bool { return a == n }},
+		} {
+			for _, limit := range []int{1, 20} {
+				want := bruteIds(limit, func(acc *Account) bool { return c.match(age(acc)) })
+				args := fmt.Sprintf("%s=%d&limit=%d", c.key, n, limit)
+				require.Equal(t, want, filterIds(t, args), args)
+			}
+			want := bruteIds(20, func(acc *Account) bool { return acc.Sex && c.match(age(acc)) })
+			args := fmt.Sprintf("%s=%d&sex_eq=m&limit=20", c.key, n)
+			require.Equal(t, want, filterIds(t, args), args)
+		}
+	}
+	for _, args := range []string{"age_gt=abc", "age_lt=-1", "age_eq=101", "age_ge=5"} {
+		code, _ := serve(t, "GET", "/accounts/filter/?"+args+"&limit=5", "")
+		require.Equal(t, 400, code, args)
+	}
+}
+
+type ageGroupCount struct {
+	Age   string `json:"age"`
+	Count int    `json:"count"`
+}
+
+func TestAgeGroupBy(t *testing.T) {
+	loadFixture(t)
+
+	for _, c := range []struct {
+		args   string
+		ranges []int
+		match  func(acc *Account) bool
+	}{
+		{"", AgeRanges, func(*Account) bool { return true }},
+		{"age_ranges=20,30,40", []int{20, 30, 40}, func(*Account) bool { return true }},
+		{"age_ranges=33&sex=f", []int{33}, func(acc *Account) bool { return !acc.Sex }},
+		{"status=" + StatusFree, AgeRanges, func(acc *Account) bool { return acc.Status == StatusFreeIx }},
+	} {
+		var want []ageGroupCount
+		for i := 0; i <= len(c.ranges); i++ {
+			label, from, to := AgeGroup(c.ranges, i)
+			cnt := 0
+			for uid := int32(1); uid < MaxId; uid++ {
+				acc := HasAccount(uid)
+				if acc == nil || !c.match(acc) {
+					continue
+				}
+				if a := calendarAge(acc.Birth, CurTs); a >= from && (to < 0 || a <= to) {
+					cnt++
+				}
+			}
+			if cnt > 0 {
+				want = append(want, ageGroupCount{label, cnt})
+			}
+		}
+		// stable sort keeps groups of equal count in age order
+		sort.SliceStable(want, func(i, j int) bool { return want[i].Count < want[j].Count })
+
+		args := escapeArgs(c.args)
+		if args != "" {
+			args += "&"
+		}
+		args += "keys=age&order=1&limit=20"
+		code, body := serve(t, "GET", "/accounts/group/?"+args, "")
+		require.Equal(t, 200, code, "%s: %s", args, body)
+		var res struct {
+			Groups []ageGroupCount `json:"groups"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+		require.NotEmpty(t, want, args)
+		require.Equal(t, want, res.Groups, args)
+	}
+
+	for _, args := range []string{"keys=age&age_ranges=25,18", "keys=age,sex", "keys=age&age_ranges="} {
+		code, _ := serve(t, "GET", "/accounts/group/?"+args+"&order=1&limit=5", "")
+		require.Equal(t, 400, code, args)
+	}
+}
@@ -2,7 +2,9 @@ package alloc2
 
 import (
 	"fmt"
+	"log"
 	"sync"
+	"syscall"
 	"unsafe"
 )
 
@@ -14,6 +16,13 @@ type Simple struct {
 	TotalFree  int
 	TotalAlloc int
 	Log        string
+	// Huge are mappings of allocations not fitting into chunk.
+	Huge []hugeMap
+}
+
+type hugeMap struct {
+	mem  []byte
+	free bool
 }
 
 type chunk struct {
@@ -31,7 +40,7 @@ func (s *Simple) Alloc(ln int) unsafe.Pointer {
 func (s *Simple) alloc(ln int) unsafe.Pointer {
 	n := 4 + (ln+3)&^3
 	if n >= ChunkSize-8 {
-		panic("no")
+		return s.allocHuge(n)
 	}
 	if s.Cur.free == nil || int(s.Cur.off)+n > ChunkSize {
 		if s.Cur.free != nil {
@@ -71,6 +80,35 @@ func (s *Simple) alloc(ln int) unsafe.Pointer {
 	return unsafe.Pointer(res)
 }
 
+// allocHuge returns allocation of size n which doesn't fit into chunk.
+// It is mapped separately with size before pointer as in chunk. Freed
+// mappings are never unmapped, since concurrent readers may still look at
+// them, but are reused by next huge allocations.
+func (s *Simple) allocHuge(n int) unsafe.Pointer {
+	for i := range s.Huge {
+		h := &s.Huge[i]
+		sz := int(*(*uint32)(unsafe.Pointer(&h.mem[4])))
+		if h.free && sz >= n {
+			h.free = false
+			s.TotalFree -= sz
+			s.TotalAlloc += sz
+			return unsafe.Pointer(&h.mem[8])
+		}
+	}
+	mem, err := mmap(0, uintptr(n+4), syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS, -1, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	*(*uint32)(unsafe.Pointer(&mem[4])) = uint32(n)
+	s.Huge = append(s.Huge, hugeMap{mem: mem})
+	s.TotalAlloc += n
+	if s.Log != "" {
+		fmt.Printf("%p alloc huge %d %s\n", unsafe.Pointer(&mem[8]), n, s.Log)
+	}
+	return unsafe.Pointer(&mem[8])
+}
+
 func (s *Simple) Dealloc(ptr unsafe.Pointer) {
 	s.Lock()
 	defer s.Unlock()
@@ -82,6 +120,10 @@ func (s *Simple) dealloc(ptr unsafe.Pointer) {
 	sz := *(*uint32)(unsafe.Pointer(up - 4))
 	s.TotalFree += int(sz)
 	s.TotalAlloc -= int(sz)
+	if sz >= ChunkSize-8 {
+		s.deallocHuge(ptr)
+		return
+	}
 	chunkp := up &^ ChunkMask
 	freep := (*int)(unsafe.Pointer(chunkp))
 	*freep += int(sz)
@@ -98,6 +140,19 @@ func (s *Simple) dealloc(ptr unsafe.Pointer) {
 	}
 }
 
+func (s *Simple) deallocHuge(ptr unsafe.Pointer) {
+	for i := range s.Huge {
+		if unsafe.Pointer(&s.Huge[i].mem[8]) == ptr {
+			s.Huge[i].free = true
+			if s.Log != "" {
+				fmt.Printf("%p dealloc huge %s\n", ptr, s.Log)
+			}
+			return
+		}
+	}
+	panic("no")
+}
+
 func (s *Simple) ChunkSpace(ptr unsafe.Pointer) int {
 	up := uintptr(ptr)
 	chunkp := up &^ ChunkMask
@@ -110,10 +165,13 @@ func (s *Simple) Compact(pptr *uintptr) {
 		return
 	}
 	up := uintptr(*pptr)
+	sz := *(*uint32)(unsafe.Pointer(up - 4))
+	if sz >= ChunkSize-8 {
+		return
+	}
 	chunkp := up &^ ChunkMask
 	freep := (*int)(unsafe.Pointer(chunkp))
 	if *freep > ChunkSize/4 {
-		sz := *(*uint32)(unsafe.Pointer(up - 4))
 		nptr := s.alloc(int(sz - 4))
 		optr := unsafe.Pointer(*pptr)
 		copy((*Chunk)(nptr)[:sz-4], (*Chunk)(optr)[:sz-4])
@@ -0,0 +1,423 @@
+package bitmap3
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Adaptive is a set of ids stored as sorted array, as list of runs or as
+// dense L3 blocks, whichever suits its cardinality:
+//   - array while there are at most ArrayMax ids,
+//   - runs when array overflows but ids form at most RunsMax runs,
+//   - dense blocks otherwise.
+//
+// Dense set returns to array when it shrinks to ArrayMax/2, so small sets
+// cost a few KB instead of ~200KB of Bitmap. L2 is maintained for every
+// kind, so Adaptive is combined by AndBitmap and OrBitmap as cheap as Bitmap.
+// Like Bitmap, L2 is not cleared by Unset.
+//
+// Representation is published by single pointer, and readers load it once
+// per call, so they never see kind of one representation with data of
+// another. Array and runs are changed in place only by appending,
+// truncating or widening a run; other changes and conversions publish new
+// representation and leave old one intact for readers still holding it.
+type Adaptive struct {
+	Size uint32
+	L2   [384]uint64
+
+	rep unsafe.Pointer // *adaptiveRep, nil for empty array
+}
+
+type adaptiveRep struct {
+	kind uint8
+	// n is used length of arr or runs, they are allocated at full capacity
+	// and only grow in place
+	n    int32
+	arr  []int32
+	runs []Run
+	l3   *[24576]uint64
+}
+
+var emptyRep adaptiveRep
+
+func (a *Adaptive) load() *adaptiveRep {
+	if r := (*adaptiveRep)(atomic.LoadPointer(&a.rep)); r != nil {
+		return r
+	}
+	return &emptyRep
+}
+
+func (a *Adaptive) publish(r *adaptiveRep) {
+	atomic.StorePointer(&a.rep, unsafe.Pointer(r))
+}
+
+func (r *adaptiveRep) getArr() []int32 {
+	return r.arr[:atomic.LoadInt32(&r.n)]
+}
+
+func (r *adaptiveRep) getRuns() []Run {
+	return r.runs[:atomic.LoadInt32(&r.n)]
+}
+
+// Run is inclusive range of ids.
+type Run struct {
+	First, Last int32
+}
+
+const (
+	ArrayMax = 4096
+	RunsMax  = 2048
+)
+
+const (
+	kindArray = iota
+	kindRuns
+	kindDense
+)
+
+// searchArr returns position of first id >= ix in ascending arr.
+func searchArr(arr []int32, ix int32) int {
+	i, j := 0, len(arr)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if arr[h] < ix {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i
+}
+
+// searchRuns returns position of first run with Last >= ix.
+func searchRuns(runs []Run, ix int32) int {
+	i, j := 0, len(runs)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if runs[h].Last < ix {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i
+}
+
+func (a *Adaptive) Set(ix int32) {
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		arr := r.getArr()
+		i := searchArr(arr, ix)
+		if i < len(arr) && arr[i] == ix {
+			return
+		}
+		a.spliceArr(r, i, 0, ix)
+	case kindRuns:
+		if !a.setRun(r, ix) {
+			return
+		}
+	case kindDense:
+		if !Set(r.l3[:], ix) {
+			return
+		}
+	}
+	a.Size++
+	Set(a.L2[:], ix/64)
+	a.convert()
+}
+
+// spliceCap returns capacity for m elements, growing old capacity c twice.
+func spliceCap(c, m int) int {
+	if c >= m {
+		return c
+	}
+	if m < 4 {
+		return 8
+	}
+	return 2 * m
+}
+
+// spliceArr replaces del ids at position i with add. Appending and
+// truncation are done in place; other changes publish a copy, since shifting
+// would hide ids from reader iterating same array.
+func (a *Adaptive) spliceArr(r *adaptiveRep, i, del int, add ...int32) {
+	n := int(r.n)
+	m := n - del + len(add)
+	if i+del == n && m <= len(r.arr) {
+		copy(r.arr[i:], add)
+		atomic.StoreInt32(&r.n, int32(m))
+		return
+	}
+	arr := make([]int32, spliceCap(len(r.arr), m))
+	copy(arr, r.arr[:i])
+	copy(arr[i:], add)
+	copy(arr[i+len(add):], r.arr[i+del:n])
+	a.publish(&adaptiveRep{kind: kindArray, n: int32(m), arr: arr})
+}
+
+// spliceRuns replaces del runs at position i with add like spliceArr.
+func (a *Adaptive) spliceRuns(r *adaptiveRep, i, del int, add ...Run) {
+	n := int(r.n)
+	m := n - del + len(add)
+	if i+del == n && m <= len(r.runs) {
+		copy(r.runs[i:], add)
+		atomic.StoreInt32(&r.n, int32(m))
+		return
+	}
+	runs := make([]Run, spliceCap(len(r.runs), m))
+	copy(runs, r.runs[:i])
+	copy(runs[i:], add)
+	copy(runs[i+len(add):], r.runs[i+del:n])
+	a.publish(&adaptiveRep{kind: kindRuns, n: int32(m), runs: runs})
+}
+
+// setRun adds ix to runs. Run is widened in place, since reader misses
+// nothing by that.
+func (a *Adaptive) setRun(r *adaptiveRep, ix int32) bool {
+	runs := r.getRuns()
+	i := searchRuns(runs, ix)
+	if i < len(runs) && runs[i].First <= ix {
+		return false
+	}
+	joinLeft := i > 0 && runs[i-1].Last == ix-1
+	joinRight := i < len(runs) && runs[i].First == ix+1
+	switch {
+	case joinLeft && joinRight:
+		a.spliceRuns(r, i-1, 2, Run{runs[i-1].First, runs[i].Last})
+	case joinLeft:
+		runs[i-1].Last = ix
+	case joinRight:
+		runs[i].First = ix
+	default:
+		a.spliceRuns(r, i, 0, Run{ix, ix})
+	}
+	return true
+}
+
+func (a *Adaptive) Unset(ix int32) {
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		arr := r.getArr()
+		i := searchArr(arr, ix)
+		if i == len(arr) || arr[i] != ix {
+			return
+		}
+		a.spliceArr(r, i, 1)
+	case kindRuns:
+		if !a.unsetRun(r, ix) {
+			return
+		}
+	case kindDense:
+		if !Unset(r.l3[:], ix) {
+			return
+		}
+	}
+	a.Size--
+	a.convert()
+}
+
+func (a *Adaptive) unsetRun(r *adaptiveRep, ix int32) bool {
+	runs := r.getRuns()
+	i := searchRuns(runs, ix)
+	if i == len(runs) || runs[i].First > ix {
+		return false
+	}
+	run := runs[i]
+	switch {
+	case run.First == run.Last:
+		a.spliceRuns(r, i, 1)
+	case run.First == ix:
+		runs[i].First++
+	case run.Last == ix:
+		runs[i].Last--
+	default:
+		a.spliceRuns(r, i, 1, Run{run.First, ix - 1}, Run{ix + 1, run.Last})
+	}
+	return true
+}
+
+// convert switches representation when current one is not suitable for
+// size anymore. New representation is filled before it is published, and
+// old one is left to readers still using it.
+func (a *Adaptive) convert() {
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		if r.n <= ArrayMax {
+			return
+		}
+		if runs := arrRuns(r.getArr()); runs != nil {
+			a.publish(&adaptiveRep{kind: kindRuns, n: int32(len(runs)), runs: runs})
+		} else {
+			a.toDense()
+		}
+	case kindRuns:
+		if r.n > RunsMax {
+			a.toDense()
+		} else if a.Size <= ArrayMax/2 && uint32(r.n) > a.Size/2 {
+			a.toArray()
+		}
+	case kindDense:
+		if a.Size <= ArrayMax/2 {
+			a.toArray()
+		}
+	}
+}
+
+// arrRuns returns runs of array, or nil if there are more than RunsMax.
+func arrRuns(arr []int32) []Run {
+	var runs []Run
+	for _, ix := range arr {
+		if n := len(runs); n > 0 && runs[n-1].Last == ix-1 {
+			runs[n-1].Last = ix
+			continue
+		}
+		if len(runs) == RunsMax {
+			return nil
+		}
+		runs = append(runs, Run{ix, ix})
+	}
+	return runs[:len(runs):len(runs)]
+}
+
+func (a *Adaptive) toDense() {
+	l3 := new([24576]uint64)
+	a.LoopBlock(func(span int32, bl uint64) bool {
+		l3[span/64] = bl
+		return true
+	})
+	a.publish(&adaptiveRep{kind: kindDense, l3: l3})
+}
+
+func (a *Adaptive) toArray() {
+	arr := make([]int32, 0, a.Size)
+	Loop(a, func(u []int32) bool {
+		arr = append(arr, u...)
+		return true
+	})
+	for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
+		arr[i], arr[j] = arr[j], arr[i]
+	}
+	a.publish(&adaptiveRep{kind: kindArray, n: int32(len(arr)), arr: arr[:cap(arr)]})
+}
+
+func (a *Adaptive) Has(ix int32) bool {
+	if ix < 0 || ix >= UpLimit || !Has(a.L2[:], ix/64) {
+		return false
+	}
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		arr := r.getArr()
+		i := searchArr(arr, ix)
+		return i < len(arr) && arr[i] == ix
+	case kindRuns:
+		runs := r.getRuns()
+		i := searchRuns(runs, ix)
+		return i < len(runs) && runs[i].First <= ix
+	default:
+		return Has(r.l3[:], ix)
+	}
+}
+
+// runBits returns bits of block span covered by run.
+func runBits(r Run, span int32) uint64 {
+	lo, hi := r.First-span, r.Last-span
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > 63 {
+		hi = 63
+	}
+	return (^uint64(0) >> uint(63-hi+lo)) << uint(lo)
+}
+
+func (a *Adaptive) GetBlock(span int32) uint64 {
+	var bl uint64
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		arr := r.getArr()
+		for i := searchArr(arr, span); i < len(arr) && arr[i] < span+64; i++ {
+			bl |= 1 << uint(arr[i]-span)
+		}
+	case kindRuns:
+		runs := r.getRuns()
+		for i := searchRuns(runs, span); i < len(runs) && runs[i].First < span+64; i++ {
+			bl |= runBits(runs[i], span)
+		}
+	default:
+		bl = r.l3[span/64]
+	}
+	return bl
+}
+
+func (a *Adaptive) LoopBlock(f func(int32, uint64) bool) {
+	r := a.load()
+	switch r.kind {
+	case kindArray:
+		arr := r.getArr()
+		for i := len(arr) - 1; i >= 0; {
+			span := arr[i] &^ 63
+			var bl uint64
+			for ; i >= 0 && arr[i] >= span; i-- {
+				bl |= 1 << uint(arr[i]-span)
+			}
+			if !f(span, bl) {
+				return
+			}
+		}
+	case kindRuns:
+		// run longer than a block is emitted in several steps, top is the
+		// highest id not emitted yet
+		runs := r.getRuns()
+		i := len(runs) - 1
+		if i < 0 {
+			return
+		}
+		for top := runs[i].Last; i >= 0; {
+			span := top &^ 63
+			var bl uint64
+			for ; i >= 0 && runs[i].Last >= span; i-- {
+				bl |= runBits(runs[i], span)
+				if runs[i].First < span {
+					break
+				}
+			}
+			if !f(span, bl) {
+				return
+			}
+			if i >= 0 {
+				top = span - 1
+				if runs[i].Last < top {
+					top = runs[i].Last
+				}
+			}
+		}
+	default:
+		l3 := r.l3
+		var l2u Unrolled
+		for l2ix := int32(len(a.L2) - 1); l2ix >= 0; l2ix-- {
+			l2v := a.L2[l2ix]
+			if l2v == 0 {
+				continue
+			}
+			for _, l3ix := range Unroll(l2v, l2ix*64, &l2u) {
+				l3v := l3[l3ix]
+				if l3v != 0 && !f(l3ix*64, l3v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *Adaptive) GetL2() *[384]uint64 {
+	return &a.L2
+}
+
+func (a *Adaptive) Count() uint32 {
+	return a.Size
+}
@@ -0,0 +1,160 @@
+package bitmap3_test
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+func TestAdaptive(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	gens := map[string]func() int32{
+		"sparse": func() int32 { return rng.Int31n(1 << 20) },
+		"dense":  func() int32 { return rng.Int31n(1 << 14) },
+		"runs": func() int32 {
+			return rng.Int31n(40)*4096 + rng.Int31n(300)
+		},
+	}
+	for name, gen := range gens {
+		var mp bitmap3.Adaptive
+		var dmb dumpmap
+		var bm bitmap3.Bitmap
+		for _, n := range []int{3, 100, 5000, 12000, -11000, -3000, 6000, -8000} {
+			for i := 0; i < n; i++ {
+				v := gen()
+				mp.Set(v)
+				dmb.Set(v)
+				bm.Set(v)
+			}
+			for i := 0; i < -n; i++ {
+				v := gen()
+				mp.Unset(v)
+				dmb.Unset(v)
+				bm.Unset(v)
+			}
+			equal(t, dmb, &mp)
+			for i := 0; i < 1000; i++ {
+				v := gen()
+				assert.Equal(t, dmb.Has(v), mp.Has(v), "%s id %d", name, v)
+				span := v &^ 63
+				assert.Equal(t, bm.GetBlock(span), mp.GetBlock(span), "%s span %d", name, span)
+			}
+			other := &bitmap3.Bitmap{}
+			for i := 0; i < 20000; i++ {
+				other.Set(gen())
+			}
+			equal(t, intersectDumb([]dumpmap{dmb, bitmapDumb(other)}),
+				bitmap3.NewAndBitmap([]bitmap3.IBitmap{&mp, other}))
+			equal(t, unionDumb([]dumpmap{dmb, bitmapDumb(other)}),
+				bitmap3.NewOrBitmap([]bitmap3.IBitmap{&mp, other}))
+		}
+	}
+}
+
+func TestAdaptive_runs(t *testing.T) {
+	var mp bitmap3.Adaptive
+	var dmb dumpmap
+	for v := int32(100); v < 20000; v++ {
+		if v%1000 != 0 {
+			mp.Set(v)
+			dmb.Set(v)
+		}
+	}
+	equal(t, dmb, &mp)
+	mp.Unset(5555)
+	dmb.Unset(5555)
+	mp.Set(3000)
+	dmb.Set(3000)
+	equal(t, dmb, &mp)
+	assert.Equal(t, ^uint64(0)&^(1<<(5555-5504)), mp.GetBlock(5504))
+}
+
+// TestAdaptive_concurrent converts set through every kind while readers
+// check ids which are never unset.
+func TestAdaptive_concurrent(t *testing.T) {
+	var mp bitmap3.Adaptive
+	const step = 1000
+	const top = 64 * step
+	for v := int32(0); v < top; v += step {
+		mp.Set(v)
+	}
+	var stop int32
+	var wg sync.WaitGroup
+	errs := make(chan string, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				for v := int32(0); v < top; v += step {
+					if !mp.Has(v) {
+						errs <- "Has"
+						return
+					}
+					if mp.GetBlock(v&^63)&(1<<uint(v&63)) == 0 {
+						errs <- "GetBlock"
+						return
+					}
+				}
+				seen := 0
+				bitmap3.Loop(&mp, func(u []int32) bool {
+					for _, v := range u {
+						if v%step == 0 {
+							seen++
+						}
+					}
+					return true
+				})
+				if seen < top/step {
+					errs <- "Loop"
+					return
+				}
+			}
+		}()
+	}
+
+	rng := rand.New(rand.NewSource(5))
+	for round := 0; round < 6; round++ {
+		var added []int32
+		add := func(v int32) {
+			if v%step != 0 && !mp.Has(v) {
+				mp.Set(v)
+				added = append(added, v)
+			}
+		}
+		// consecutive ids become runs, then random ones make it dense
+		for v := int32(1); v < 6000; v++ {
+			add(v)
+		}
+		for i := 0; i < 6000; i++ {
+			add(rng.Int31n(top))
+		}
+		rng.Shuffle(len(added), func(i, j int) { added[i], added[j] = added[j], added[i] })
+		for _, v := range added {
+			mp.Unset(v)
+		}
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error("reader missed permanent id in", e)
+	}
+	assert.Equal(t, uint32(top/step), mp.Count())
+}
+
+func bitmapDumb(bm *bitmap3.Bitmap) dumpmap {
+	var res dumpmap
+	bitmap3.Loop(bm, func(u []int32) bool {
+		for _, v := range u {
+			res.Set(v)
+		}
+		return true
+	})
+	return res
+}
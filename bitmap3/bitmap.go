@@ -1,5 +1,7 @@
 package bitmap3
 
+import "math/bits"
+
 type Bitmap struct {
 	Size uint32
 	L2   [384]uint64
@@ -21,6 +23,19 @@ func (bm *Bitmap) Unset(ix int32) {
 	}
 }
 
+// Reset clears bitmap touching only blocks marked in L2, so reusing
+// sparse bitmap is cheap.
+func (bm *Bitmap) Reset() {
+	for i, v := range bm.L2 {
+		for v != 0 {
+			bm.L3[i*64+bits.TrailingZeros64(v)] = 0
+			v &= v - 1
+		}
+		bm.L2[i] = 0
+	}
+	bm.Size = 0
+}
+
 func (bm *Bitmap) Has(ix int32) bool {
 	return ix < UpLimit && Has(bm.L2[:], ix/64) && Has(bm.L3[:], ix)
 }
@@ -30,6 +30,19 @@ func TestBitmap_simple(t *testing.T) {
 	assert.Equal(t, uint32(3), mp.Count())
 }
 
+func TestBitmap_Reset(t *testing.T) {
+	mp := bitmap3.Bitmap{}
+	for _, ix := range []int32{1, 63, 64, 20000, 1020000} {
+		mp.Set(ix)
+	}
+	mp.Unset(64)
+	mp.Reset()
+	assert.Equal(t, uint32(0), mp.Count())
+	assert.Equal(t, bitmap3.Bitmap{}, mp)
+	mp.Set(5)
+	assert.Equal(t, []int32{5}, unroll(&mp))
+}
+
 func TestBitmap_huge(t *testing.T) {
 	rng := rand.New(rand.NewSource(1))
 	gens := []func() int32{
@@ -147,3 +160,48 @@ func intersectDumb(dmb []dumpmap) dumpmap {
 	}
 	return res
 }
+
+type mutBitmap interface {
+	bitmap3.IBitmap
+	Set(int32)
+	Unset(int32)
+}
+
+// TestMutable is ported from bitmap2 bitmap and huge tests: sets of growing
+// size are filled, then quarter of ids is unset.
+func TestMutable(t *testing.T) {
+	news := map[string]func() mutBitmap{
+		"Bitmap":   func() mutBitmap { return &bitmap3.Bitmap{} },
+		"Adaptive": func() mutBitmap { return &bitmap3.Adaptive{} },
+	}
+	for name, newBm := range news {
+		rng := rand.New(rand.NewSource(1))
+		gens := append(mutGens(rng),
+			idGen{"sparse 1000", 1000, func() int32 { return rng.Int31n(1 << 20) }},
+			idGen{"1<<17", 60000, func() int32 { return rng.Int31n(1 << 17) }},
+		)
+		for _, g := range gens {
+			for k := 1; k <= g.max; k += k/4 + 1 {
+				mp := newBm()
+				var dmb dumpmap
+				for dmb.Count() < uint32(k) {
+					v := g.gen()
+					mp.Set(v)
+					dmb.Set(v)
+				}
+				equal(t, dmb, mp)
+
+				ids := dmb.Array()
+				rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+				for _, v := range ids[:k/4+1] {
+					mp.Unset(v)
+					dmb.Unset(v)
+				}
+				equal(t, dmb, mp)
+				for _, v := range ids[:k/4+1] {
+					require.False(t, mp.Has(v), "%s %s k %d id %d", name, g.name, k, v)
+				}
+			}
+		}
+	}
+}
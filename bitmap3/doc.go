@@ -0,0 +1,35 @@
+// Package bitmap3 implements sets of account ids used as indexes.
+//
+// Ids are below UpLimit and are split into blocks of 64 ids: block of span
+// s is uint64 with bit i set if id s+i is in set. Every bitmap implements
+// IBitmap:
+//
+//	LoopBlock(f)   calls f for nonempty blocks in descending span order
+//	               until f returns false;
+//	GetBlock(span) returns block of span;
+//	GetL2()        returns summary with bit span/64 set for every nonempty
+//	               block (it may have extra bits after Unset);
+//	Has(id)        checks single id.
+//
+// Size is tracked by Counter (Count); package function Count falls back to
+// iteration for bitmaps without it. Loop iterates ids in descending order
+// and uses Looper if bitmap can pass ids without unrolling blocks.
+//
+// Mutable sets:
+//
+//	Bitmap    dense L3 blocks, ~200KB fixed, fastest GetBlock;
+//	Adaptive  array, runs or dense blocks chosen by cardinality;
+//	SexMap    ids of one parity, only L2 of used blocks is stored;
+//	Small     sorted array in SmallAlloc arena (not IBitmap);
+//	Likes     like events in LikesAlloc arena (not IBitmap).
+//
+// Composites are computed lazily block by block from L2 summaries:
+// NewAndBitmap, NewOrBitmap and NewThresholdBitmap. They cache last block,
+// so single composite must not be used concurrently. RawUids (ids sorted
+// descending) and RawWithMap are results too small to be worth blocks;
+// they implement only Loop and Has. Materialize copies blocks of any
+// bitmap into immutable Materialized, which is cheap to iterate again.
+//
+// Mutation is not synchronized: writers are serialized by caller, while
+// readers may run concurrently and see sets in the middle of update.
+package bitmap3
@@ -26,7 +26,12 @@ func (r RawUids) Count() uint32                    { return uint32(len(r)) }
 func (RawUids) LoopBlock(func(int32, uint64) bool) { panic("no") }
 func (RawUids) GetL2() *[384]uint64                { panic("no"); return nil }
 func (RawUids) GetBlock(int32) uint64              { panic("no"); return 0 }
-func (RawUids) Has(int32) bool                     { panic("no"); return false }
+
+// Has expects uids to be sorted descending.
+func (r RawUids) Has(ix int32) bool {
+	i := sort.Search(len(r), func(i int) bool { return r[i] <= ix })
+	return i < len(r) && r[i] == ix
+}
 
 type RawWithMap struct {
 	R RawUids
@@ -36,7 +41,10 @@ type RawWithMap struct {
 func (RawWithMap) LoopBlock(func(int32, uint64) bool) { panic("no") }
 func (RawWithMap) GetL2() *[384]uint64                { panic("no"); return nil }
 func (RawWithMap) GetBlock(int32) uint64              { panic("no"); return 0 }
-func (RawWithMap) Has(int32) bool                     { panic("no"); return false }
+
+func (r RawWithMap) Has(ix int32) bool {
+	return r.R.Has(ix) && r.M.Has(ix)
+}
 
 func (r RawWithMap) Loop(f func([]int32) bool) {
 	var s [1]int32
@@ -86,7 +94,7 @@ func NewAndBitmap(maps []IBitmap) IBitmap {
 	sort.Slice(maps, func(i, j int) bool {
 		return cnt(maps[i]) < cnt(maps[j])
 	})
-	bm := &AndBitmap{Maps: maps}
+	bm := &AndBitmap{Maps: maps, LastSpan: -1}
 	for i := range bm.L2 {
 		bm.L2[i] = ^uint64(0)
 	}
@@ -168,7 +176,7 @@ func NewOrBitmap(maps []IBitmap) IBitmap {
 	if len(maps) == 1 {
 		return maps[0]
 	}
-	bm := &OrBitmap{Maps: maps}
+	bm := &OrBitmap{Maps: maps, LastSpan: -1}
 	for _, m := range maps {
 		for i, v := range m.GetL2() {
 			bm.L2[i] |= v
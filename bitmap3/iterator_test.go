@@ -0,0 +1,205 @@
+package bitmap3_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// TestFirstBlock checks that fresh composite doesn't take its first block
+// for cached one.
+func TestFirstBlock(t *testing.T) {
+	a, b := &bitmap3.Bitmap{}, &bitmap3.Bitmap{}
+	a.Set(5)
+	a.Set(100)
+	b.Set(5)
+	b.Set(7)
+
+	and := bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, b})
+	assert.Equal(t, uint64(1<<5), and.GetBlock(0))
+	assert.True(t, and.Has(5))
+
+	or := bitmap3.NewOrBitmap([]bitmap3.IBitmap{a, b})
+	assert.Equal(t, uint64(1<<5|1<<7), or.GetBlock(0))
+	assert.True(t, or.Has(7))
+
+	// composite nested into composite is asked for blocks by GetBlock
+	c := &bitmap3.Bitmap{}
+	c.Set(5)
+	c.Set(7)
+	nested := bitmap3.NewAndBitmap([]bitmap3.IBitmap{c, bitmap3.NewOrBitmap([]bitmap3.IBitmap{a, b})})
+	var ids []int32
+	bitmap3.Loop(nested, func(u []int32) bool {
+		ids = append(ids, u...)
+		return true
+	})
+	assert.Equal(t, []int32{7, 5}, ids)
+}
+
+// iterBuilders make bases of composites in TestIterator.
+var iterBuilders = map[string]func(dmb dumpmap) bitmap3.IBitmap{
+	"Bitmap": func(dmb dumpmap) bitmap3.IBitmap {
+		bm := &bitmap3.Bitmap{}
+		for id := range dmb.m {
+			bm.Set(id)
+		}
+		return bm
+	},
+	"Adaptive": func(dmb dumpmap) bitmap3.IBitmap {
+		a := &bitmap3.Adaptive{}
+		for id := range dmb.m {
+			a.Set(id)
+		}
+		return a
+	},
+	"Materialized": func(dmb dumpmap) bitmap3.IBitmap {
+		bm := &bitmap3.Bitmap{}
+		for id := range dmb.m {
+			bm.Set(id)
+		}
+		return bitmap3.Materialize(bm)
+	},
+}
+
+// TestIterator is ported bitmap2 test: unions and intersections of 2..5
+// sets of every size are compared with model, directly and materialized.
+func TestIterator(t *testing.T) {
+	rng := rand.New(rand.NewSource(99))
+	gens := []func() int32{
+		func() int32 { return rng.Int31n(1 << 20) },
+		func() int32 { return rng.Int31n(1 << 14) },
+		func() int32 {
+			n := rng.Int31n(1 << 16)
+			return n%256 + n/256*497
+		},
+	}
+	for name, build := range iterBuilders {
+		for k := 1; k < 10000; k += k/2 + 1 {
+			for itk := 2; itk < 6; itk++ {
+				for _, gen := range gens {
+					testIter(t, name, k, itk, gen, build)
+				}
+			}
+		}
+		for itk := 2; itk < 6; itk++ {
+			testIter(t, name, 500, itk, func() int32 { return rng.Int31n(512) }, build)
+		}
+	}
+}
+
+func testIter(t *testing.T, name string, k, itk int, gen func() int32, build func(dumpmap) bitmap3.IBitmap) {
+	dumbs := make([]dumpmap, itk)
+	maps := make([]bitmap3.IBitmap, itk)
+	for i := range dumbs {
+		for dumbs[i].Count() < uint32(k) {
+			dumbs[i].Set(gen())
+		}
+		maps[i] = build(dumbs[i])
+	}
+	orDumb, andDumb := unionDumb(dumbs), intersectDumb(dumbs)
+	for i := range maps {
+		equal(t, dumbs[i], maps[i])
+	}
+	equal(t, orDumb, bitmap3.NewOrBitmap(maps))
+	equal(t, andDumb, bitmap3.NewAndBitmap(maps))
+	equal(t, orDumb, bitmap3.Materialize(bitmap3.NewOrBitmap(maps)))
+	equal(t, andDumb, bitmap3.Materialize(bitmap3.NewAndBitmap(maps)))
+	if t.Failed() {
+		t.Fatalf("%s k %d itk %d", name, k, itk)
+	}
+}
+
+// TestIteratorSemantics checks composites are iterated in descending order,
+// stop when asked and are not confused by lookups between blocks.
+func TestIteratorSemantics(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	var da, db dumpmap
+	a, b := &bitmap3.Bitmap{}, &bitmap3.Adaptive{}
+	for i := 0; i < 3000; i++ {
+		v := rng.Int31n(1 << 15)
+		a.Set(v)
+		da.Set(v)
+		v = rng.Int31n(1 << 15)
+		b.Set(v)
+		db.Set(v)
+	}
+	models := map[string]dumpmap{
+		"and": intersectDumb([]dumpmap{da, db}),
+		"or":  unionDumb([]dumpmap{da, db}),
+	}
+	news := map[string]func() bitmap3.IBitmap{
+		"and": func() bitmap3.IBitmap { return bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, b}) },
+		"or":  func() bitmap3.IBitmap { return bitmap3.NewOrBitmap([]bitmap3.IBitmap{a, b}) },
+	}
+	for name, newMp := range news {
+		dmb := models[name]
+
+		// lookups of other spans between blocks don't change result, and
+		// composite may be iterated again
+		mp := newMp()
+		var ids []int32
+		last := int32(bitmap3.UpLimit)
+		mp.LoopBlock(func(span int32, bl uint64) bool {
+			assert.True(t, span < last, name)
+			last = span
+			var u bitmap3.Unrolled
+			ids = append(ids, bitmap3.Unroll(bl, span, &u)...)
+			v := rng.Int31n(1 << 15)
+			assert.Equal(t, dmb.Has(v), mp.Has(v), "%s id %d", name, v)
+			return true
+		})
+		assert.Equal(t, dmb.Array(), ids, name)
+		equal(t, dmb, mp)
+
+		// empty blocks asked before loop are skipped by it
+		mp = newMp()
+		for i := 0; i < 2000; i++ {
+			v := rng.Int31n(1 << 15)
+			assert.Equal(t, dmb.Has(v), mp.Has(v), "%s id %d", name, v)
+		}
+		equal(t, dmb, mp)
+
+		// loop stops when f returns false
+		seen := 0
+		newMp().LoopBlock(func(int32, uint64) bool {
+			seen++
+			return seen < 3
+		})
+		assert.Equal(t, 3, seen, name)
+	}
+
+	assert.Equal(t, bitmap3.NullBitmap{}, bitmap3.NewAndBitmap(nil))
+	assert.Equal(t, bitmap3.NullBitmap{}, bitmap3.NewOrBitmap(nil))
+	assert.Equal(t, bitmap3.IBitmap(a), bitmap3.NewAndBitmap([]bitmap3.IBitmap{a}))
+	assert.Equal(t, bitmap3.IBitmap(b), bitmap3.NewOrBitmap([]bitmap3.IBitmap{b}))
+	assert.Equal(t, bitmap3.NullBitmap{}, bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, bitmap3.NullBitmap{}, b}))
+
+	// raw uids are filtered by the rest of intersection
+	raw := bitmap3.RawUids{30000, 2000, 1000, 5, 1}
+	and := bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, raw, b})
+	var want []int32
+	for _, v := range raw {
+		if da.Has(v) && db.Has(v) {
+			want = append(want, v)
+		}
+	}
+	var got []int32
+	bitmap3.Loop(and, func(u []int32) bool {
+		got = append(got, u...)
+		return true
+	})
+	assert.Equal(t, want, got)
+	for _, v := range raw {
+		assert.Equal(t, da.Has(v) && db.Has(v), and.Has(v), "id %d", v)
+	}
+	got = got[:0]
+	empty := bitmap3.NewAndBitmap([]bitmap3.IBitmap{bitmap3.RawUids{7, 6, 5}, bitmap3.NullBitmap{}})
+	bitmap3.Loop(empty, func(u []int32) bool {
+		got = append(got, u...)
+		return true
+	})
+	assert.Empty(t, got)
+}
@@ -13,16 +13,26 @@ type Likes struct {
 }
 
 type LikesImpl struct {
-	Size uint16
-	Cap  uint16
-	Data [256]LikesElem
+	Size uint32
+	Cap  uint32
+	Data [1 << 26]LikesElem
 }
 
+// Every like event is stored as separate element. Elements are sorted by Uid
+// descending, events of the same liker are adjacent in insertion order.
 type LikesElem struct {
 	Uid int32
 	Ts  int32
 }
 
+// LikeStat is aggregated history of likes from one liker.
+type LikeStat struct {
+	Uid    int32
+	Count  int32
+	Avg    int32
+	Latest int32
+}
+
 func GetLikes(p *uintptr) *Likes {
 	return (*Likes)(unsafe.Pointer(p))
 }
@@ -31,60 +41,93 @@ func (s *Likes) Uintptr() uintptr {
 	return uintptr(unsafe.Pointer(s.LikesImpl))
 }
 
-var LikesCnt = make(map[[2]int32]int32)
-
-func (s *Likes) SetTs(likee, liker int32, ts int32) {
+// SetTs stores like event. It returns true if it is first like from liker.
+func (s *Likes) SetTs(likee, liker int32, ts int32) bool {
 	if s.LikesImpl == nil {
-		ncap := uint16(2)
-		s.LikesImpl = (*LikesImpl)(LikesAlloc.Alloc(4 + int(ncap)*8))
+		ncap := uint32(2)
+		s.LikesImpl = (*LikesImpl)(LikesAlloc.Alloc(8 + int(ncap)*8))
 		s.Size = 1
 		s.Cap = ncap
 		s.Data[0] = LikesElem{liker, ts}
-		return
+		return true
 	}
 	ix := searchSparseLikes(s.Data[:s.Size], liker)
-	if ix < int(s.Size) && s.Data[ix].Uid == liker {
-		el := &s.Data[ix]
-		if el.Ts > 0 {
-			LikesCnt[[2]int32{likee, liker}] = 2
-			el.Ts = -int32((int64(el.Ts) + int64(ts)) / 2)
-		} else {
-			cnt := int64(LikesCnt[[2]int32{likee, liker}])
-			LikesCnt[[2]int32{likee, liker}] = int32(cnt + 1)
-			el.Ts = -int32((int64(-el.Ts)*cnt + int64(ts)) / (cnt + 1))
-		}
-		return
+	first := true
+	for ix < int(s.Size) && s.Data[ix].Uid == liker {
+		first = false
+		ix++
 	}
 	if s.Size == s.Cap {
+		// storage larger than chunk is allocated separately by LikesAlloc
 		ncap := s.Cap * 2
-		ptr := LikesAlloc.Alloc(4 + int(ncap)*8)
-		//fmt.Printf("%p alloc ncap %d\n", ptr, 4+int(ncap)*8)
+		ptr := LikesAlloc.Alloc(8 + int(ncap)*8)
+		//fmt.Printf("%p alloc ncap %d\n", ptr, 8+int(ncap)*8)
 		newImpl := (*LikesImpl)(ptr)
 		newImpl.Size = s.Size
 		newImpl.Cap = ncap
 		copy(newImpl.Data[:s.Size], s.Data[:s.Size])
-		//fmt.Printf("%p dealloc ncap %d\n", s.LikesImpl, 4+int(s.Cap)*8)
+		//fmt.Printf("%p dealloc ncap %d\n", s.LikesImpl, 8+int(s.Cap)*8)
 		LikesAlloc.Dealloc(unsafe.Pointer(s.LikesImpl))
 		s.LikesImpl = newImpl
 	}
 	copy(s.Data[ix+1:s.Size+1], s.Data[ix:s.Size])
 	s.Data[ix] = LikesElem{liker, ts}
 	s.Size++
+	return first
 }
 
-func (s *Likes) GetTs(id int32) int32 {
+func likeStat(events []LikesElem) LikeStat {
+	st := LikeStat{Uid: events[0].Uid, Count: int32(len(events))}
+	sum := int64(0)
+	for _, ev := range events {
+		sum += int64(ev.Ts)
+		if ev.Ts > st.Latest {
+			st.Latest = ev.Ts
+		}
+	}
+	st.Avg = int32(sum / int64(len(events)))
+	return st
+}
+
+// Stat returns aggregated likes history of liker id.
+func (s *Likes) Stat(id int32) (LikeStat, bool) {
 	if s.LikesImpl == nil || s.Size == 0 {
-		return 0
+		return LikeStat{}, false
+	}
+	data := s.Data[:s.Size]
+	ix := searchSparseLikes(data, id)
+	j := ix
+	for j < len(data) && data[j].Uid == id {
+		j++
+	}
+	if j == ix {
+		return LikeStat{}, false
 	}
-	ix := searchSparseLikes(s.Data[:s.Size], id)
-	if ix < int(s.Size) && s.Data[ix].Uid == id {
-		ts := s.Data[ix].Ts
-		if ts < 0 {
-			return -ts
+	return likeStat(data[ix:j]), true
+}
+
+// Stats calls f for every distinct liker in Uid descending order.
+func (s *Likes) Stats(f func(st LikeStat) bool) {
+	if s.LikesImpl == nil {
+		return
+	}
+	data := s.Data[:s.Size]
+	for len(data) > 0 {
+		j := 1
+		for j < len(data) && data[j].Uid == data[0].Uid {
+			j++
+		}
+		if !f(likeStat(data[:j])) {
+			return
 		}
-		return ts
+		data = data[j:]
 	}
-	return 0
+}
+
+// GetTs returns average timestamp of likes from id.
+func (s *Likes) GetTs(id int32) int32 {
+	st, _ := s.Stat(id)
+	return st.Avg
 }
 
 func AndLikes(likes []*Likes) RawUids {
@@ -96,9 +139,11 @@ func AndLikes(likes []*Likes) RawUids {
 		slices[i] = l.Data[:l.Size]
 	}
 	if len(slices) == 1 {
-		res := make([]int32, len(slices[0]))
+		res := make([]int32, 0, len(slices[0]))
 		for i, el := range slices[0] {
-			res[i] = el.Uid
+			if i == 0 || el.Uid != slices[0][i-1].Uid {
+				res = append(res, el.Uid)
+			}
 		}
 		return res
 	}
@@ -125,7 +170,12 @@ func AndLikes(likes []*Likes) RawUids {
 			cur = curSlice[0].Uid
 			curcnt = 1
 		}
-		slices[cursl] = curSlice[1:]
+		// skip repeated likes of the same liker
+		uid := curSlice[0].Uid
+		for len(curSlice) > 0 && curSlice[0].Uid == uid {
+			curSlice = curSlice[1:]
+		}
+		slices[cursl] = curSlice
 		if cursl++; cursl == len(slices) {
 			cursl = 0
 		}
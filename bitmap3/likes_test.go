@@ -1,10 +1,12 @@
 package bitmap3_test
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/funny-falcon/highloadcup2018/alloc2"
 	"github.com/funny-falcon/highloadcup2018/bitmap3"
 )
 
@@ -31,7 +33,7 @@ func TestAndLikes(t *testing.T) {
 	likes3.SetTs(1, 12, 1)
 	likes3.SetTs(1, 15, 1)
 
-	correct := []int32{12, 6}
+	correct := bitmap3.RawUids{12, 6}
 	require.Equal(t, correct, bitmap3.AndLikes([]*bitmap3.Likes{likes1, likes2, likes3}))
 	require.Equal(t, correct, bitmap3.AndLikes([]*bitmap3.Likes{likes1, likes3, likes2}))
 	require.Equal(t, correct, bitmap3.AndLikes([]*bitmap3.Likes{likes2, likes1, likes3}))
@@ -39,3 +41,148 @@ func TestAndLikes(t *testing.T) {
 	require.Equal(t, correct, bitmap3.AndLikes([]*bitmap3.Likes{likes3, likes1, likes2}))
 	require.Equal(t, correct, bitmap3.AndLikes([]*bitmap3.Likes{likes3, likes2, likes1}))
 }
+
+func TestLikesHistory(t *testing.T) {
+	likes := &bitmap3.Likes{}
+	likes.SetTs(1, 5, 100)
+	likes.SetTs(1, 3, 50)
+	likes.SetTs(1, 5, 300)
+	likes.SetTs(1, 9, 10)
+	likes.SetTs(1, 5, 200)
+
+	st, ok := likes.Stat(5)
+	require.True(t, ok)
+	require.Equal(t, bitmap3.LikeStat{Uid: 5, Count: 3, Avg: 200, Latest: 300}, st)
+	require.Equal(t, int32(200), likes.GetTs(5))
+
+	st, ok = likes.Stat(3)
+	require.True(t, ok)
+	require.Equal(t, bitmap3.LikeStat{Uid: 3, Count: 1, Avg: 50, Latest: 50}, st)
+
+	_, ok = likes.Stat(4)
+	require.False(t, ok)
+
+	var uids []int32
+	likes.Stats(func(st bitmap3.LikeStat) bool {
+		uids = append(uids, st.Uid)
+		return true
+	})
+	require.Equal(t, []int32{9, 5, 3}, uids)
+
+	other := &bitmap3.Likes{}
+	other.SetTs(2, 5, 1)
+	other.SetTs(2, 5, 2)
+	other.SetTs(2, 4, 1)
+	require.Equal(t, bitmap3.RawUids{5}, bitmap3.AndLikes([]*bitmap3.Likes{likes, other}))
+	require.Equal(t, bitmap3.RawUids{5}, bitmap3.AndLikes([]*bitmap3.Likes{other, likes}))
+	require.Equal(t, bitmap3.RawUids{5, 4}, bitmap3.AndLikes([]*bitmap3.Likes{other}))
+}
+
+func TestLikesGrowsPastChunk(t *testing.T) {
+	likes := &bitmap3.Likes{}
+	n := 3 * alloc2.ChunkSize / 8
+	firsts := 0
+	for i := 0; i < n; i++ {
+		if likes.SetTs(1, int32(i%7+1), int32(i)) {
+			firsts++
+		}
+	}
+	require.Equal(t, 7, firsts)
+	require.Equal(t, uint32(n), likes.Size)
+	total := int32(0)
+	likes.Stats(func(st bitmap3.LikeStat) bool {
+		total += st.Count
+		return true
+	})
+	require.Equal(t, int32(n), total)
+	st, ok := likes.Stat(7)
+	require.True(t, ok)
+	require.Equal(t, int32(n/7), st.Count)
+	require.Equal(t, int32(n-n%7-1), st.Latest)
+
+	// huge storage is not moved by compaction
+	p := likes.Uintptr()
+	bitmap3.LikesAlloc.Compact(&p)
+	require.Equal(t, likes.Uintptr(), p)
+	require.False(t, likes.SetTs(1, 7, 0))
+}
+
+// likesModel is like events kept by liker in insertion order.
+type likesModel map[int32][]int32
+
+func (m likesModel) stat(uid int32) bitmap3.LikeStat {
+	evs := m[uid]
+	st := bitmap3.LikeStat{Uid: uid, Count: int32(len(evs))}
+	sum := int64(0)
+	for _, ts := range evs {
+		sum += int64(ts)
+		if ts > st.Latest {
+			st.Latest = ts
+		}
+	}
+	st.Avg = int32(sum / int64(len(evs)))
+	return st
+}
+
+func (m likesModel) dumb() dumpmap {
+	var res dumpmap
+	for uid := range m {
+		res.Set(uid)
+	}
+	return res
+}
+
+// TestLikes is ported bitmap2 test: likes of every generator and size are
+// compared with model, including repeated likes of the same liker.
+func TestLikes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, g := range mutGens(rng) {
+		for k := 1; k <= g.max; k += k/4 + 1 {
+			var all []*bitmap3.Likes
+			var models []likesModel
+			for j := 0; j < 3; j++ {
+				likes := &bitmap3.Likes{}
+				model := likesModel{}
+				for len(model) < k {
+					uid := g.gen()
+					ts := 1500000000 + rng.Int31n(1000)
+					_, seen := model[uid]
+					require.Equal(t, !seen, likes.SetTs(1, uid, ts), "%s k %d uid %d", g.name, k, uid)
+					model[uid] = append(model[uid], ts)
+				}
+
+				var stats []bitmap3.LikeStat
+				likes.Stats(func(st bitmap3.LikeStat) bool {
+					stats = append(stats, st)
+					return true
+				})
+				var want []bitmap3.LikeStat
+				for _, uid := range model.dumb().Array() {
+					want = append(want, model.stat(uid))
+				}
+				require.Equal(t, want, stats, "%s k %d", g.name, k)
+				for i := 0; i < 50; i++ {
+					uid := g.gen()
+					st, ok := likes.Stat(uid)
+					_, has := model[uid]
+					require.Equal(t, has, ok, "%s k %d uid %d", g.name, k, uid)
+					if has {
+						require.Equal(t, model.stat(uid), st)
+						require.Equal(t, st.Avg, likes.GetTs(uid))
+					}
+				}
+				all = append(all, likes)
+				models = append(models, model)
+			}
+
+			for n := 1; n <= len(all); n++ {
+				dumbs := make([]dumpmap, n)
+				for i := range dumbs {
+					dumbs[i] = models[i].dumb()
+				}
+				want := bitmap3.RawUids(intersectDumb(dumbs).Array())
+				require.Equal(t, want, bitmap3.AndLikes(all[:n]), "%s k %d n %d", g.name, k, n)
+			}
+		}
+	}
+}
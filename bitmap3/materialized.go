@@ -0,0 +1,63 @@
+package bitmap3
+
+import "math/bits"
+
+// Materialized is immutable copy of nonempty blocks of some bitmap in
+// descending span order. Composite bitmaps (AndBitmap, OrBitmap,
+// ThresholdBitmap) recompute blocks on every pass, so result which is
+// iterated or combined several times is worth materializing.
+type Materialized struct {
+	Size   uint32
+	L2     [384]uint64
+	Spans  []int32
+	Blocks []uint64
+}
+
+func Materialize(m LoopBlocker) *Materialized {
+	mt := &Materialized{}
+	m.LoopBlock(func(span int32, bl uint64) bool {
+		mt.Spans = append(mt.Spans, span)
+		mt.Blocks = append(mt.Blocks, bl)
+		mt.Size += uint32(bits.OnesCount64(bl))
+		Set(mt.L2[:], span/64)
+		return true
+	})
+	return mt
+}
+
+func (mt *Materialized) LoopBlock(f func(int32, uint64) bool) {
+	for i, span := range mt.Spans {
+		if !f(span, mt.Blocks[i]) {
+			return
+		}
+	}
+}
+
+func (mt *Materialized) GetL2() *[384]uint64 {
+	return &mt.L2
+}
+
+func (mt *Materialized) GetBlock(span int32) uint64 {
+	spans := mt.Spans
+	i, j := 0, len(spans)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if spans[h] > span {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	if i < len(spans) && spans[i] == span {
+		return mt.Blocks[i]
+	}
+	return 0
+}
+
+func (mt *Materialized) Has(ix int32) bool {
+	return mt.GetBlock(ix&^63)&(1<<uint(ix&63)) != 0
+}
+
+func (mt *Materialized) Count() uint32 {
+	return mt.Size
+}
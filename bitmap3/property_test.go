@@ -0,0 +1,195 @@
+package bitmap3_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// builders construct bitmaps of every kind containing exactly ids of dmb.
+// rest are distinct ids not in dmb to be used as noise.
+var builders = map[string]func(dmb dumpmap, rest []int32) bitmap3.IBitmap{
+	"Bitmap": func(dmb dumpmap, _ []int32) bitmap3.IBitmap {
+		bm := &bitmap3.Bitmap{}
+		for id := range dmb.m {
+			bm.Set(id)
+		}
+		return bm
+	},
+	"Adaptive": func(dmb dumpmap, rest []int32) bitmap3.IBitmap {
+		a := &bitmap3.Adaptive{}
+		for _, id := range rest {
+			a.Set(id)
+		}
+		for id := range dmb.m {
+			a.Set(id)
+		}
+		for _, id := range rest {
+			a.Unset(id)
+		}
+		return a
+	},
+	"Materialized": func(dmb dumpmap, _ []int32) bitmap3.IBitmap {
+		bm := &bitmap3.Bitmap{}
+		for id := range dmb.m {
+			bm.Set(id)
+		}
+		return bitmap3.Materialize(bm)
+	},
+	"Or": func(dmb dumpmap, _ []int32) bitmap3.IBitmap {
+		parts := make([]bitmap3.IBitmap, 3)
+		for i := range parts {
+			parts[i] = &bitmap3.Bitmap{}
+		}
+		for id := range dmb.m {
+			parts[id%3].(*bitmap3.Bitmap).Set(id)
+		}
+		return bitmap3.NewOrBitmap(parts)
+	},
+	"And": func(dmb dumpmap, rest []int32) bitmap3.IBitmap {
+		a, b := &bitmap3.Bitmap{}, &bitmap3.Adaptive{}
+		for id := range dmb.m {
+			a.Set(id)
+			b.Set(id)
+		}
+		for i, id := range rest {
+			if i%2 == 0 {
+				a.Set(id)
+			} else {
+				b.Set(id)
+			}
+		}
+		return bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, b})
+	},
+	"Threshold": func(dmb dumpmap, rest []int32) bitmap3.IBitmap {
+		maps := []*bitmap3.Bitmap{{}, {}, {}}
+		for id := range dmb.m {
+			maps[id%3].Set(id)
+			maps[(id+1)%3].Set(id)
+		}
+		for _, id := range rest {
+			maps[id%3].Set(id)
+		}
+		return bitmap3.NewThresholdBitmap([]bitmap3.IBitmap{maps[0], maps[1], maps[2]}, 2)
+	},
+	"MaterializedAnd": func(dmb dumpmap, rest []int32) bitmap3.IBitmap {
+		a, b := &bitmap3.Bitmap{}, &bitmap3.Bitmap{}
+		for id := range dmb.m {
+			a.Set(id)
+			b.Set(id)
+		}
+		for _, id := range rest {
+			a.Set(id)
+		}
+		return bitmap3.Materialize(bitmap3.NewAndBitmap([]bitmap3.IBitmap{a, b}))
+	},
+}
+
+var idGens = map[string]func(rng *rand.Rand) int32{
+	"sparse": func(rng *rand.Rand) int32 { return rng.Int31n(bitmap3.UpLimit) },
+	"medium": func(rng *rand.Rand) int32 { return rng.Int31n(1 << 17) },
+	"dense":  func(rng *rand.Rand) int32 { return rng.Int31n(1 << 14) },
+	"runs": func(rng *rand.Rand) int32 {
+		return rng.Int31n(64)*20000 + rng.Int31n(1000)
+	},
+	"edges": func(rng *rand.Rand) int32 {
+		edges := []int32{0, 1, 63, 64, 65, 127, 4095, 4096, bitmap3.UpLimit - 65,
+			bitmap3.UpLimit - 64, bitmap3.UpLimit - 2, bitmap3.UpLimit - 1}
+		return edges[rng.Intn(len(edges))]
+	},
+}
+
+func blockOf(dmb dumpmap, span int32) uint64 {
+	var bl uint64
+	for i := int32(0); i < 64; i++ {
+		if dmb.Has(span + i) {
+			bl |= 1 << uint(i)
+		}
+	}
+	return bl
+}
+
+func checkProps(t *testing.T, rng *rand.Rand, gen func(*rand.Rand) int32, dmb dumpmap, mp bitmap3.IBitmap, msg string) {
+	equal(t, dmb, mp)
+
+	last := int32(bitmap3.UpLimit)
+	calls := 0
+	mp.LoopBlock(func(span int32, bl uint64) bool {
+		calls++
+		require.True(t, span < last && span%64 == 0, "%s: span %d after %d", msg, span, last)
+		require.NotZero(t, bl, "%s: empty block %d", msg, span)
+		require.True(t, bitmap3.Has(mp.GetL2()[:], span/64), "%s: span %d not in L2", msg, span)
+		require.Equal(t, blockOf(dmb, span), bl, "%s: block %d", msg, span)
+		last = span
+		return true
+	})
+
+	stops := 0
+	mp.LoopBlock(func(int32, uint64) bool {
+		stops++
+		return false
+	})
+	if calls > 0 {
+		assert.Equal(t, 1, stops, msg)
+	} else {
+		assert.Equal(t, 0, stops, msg)
+	}
+
+	for i := 0; i < 300; i++ {
+		id := gen(rng)
+		assert.Equal(t, dmb.Has(id), mp.Has(id), "%s: has %d", msg, id)
+		span := id &^ 63
+		assert.Equal(t, blockOf(dmb, span), mp.GetBlock(span), "%s: block %d", msg, span)
+	}
+	for id := range dmb.m {
+		if !mp.Has(id) {
+			t.Fatalf("%s: lost %d", msg, id)
+		}
+	}
+}
+
+func TestIBitmapProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for gname, gen := range idGens {
+		for _, n := range []int{0, 1, 40, 3000, 9000} {
+			var dmb dumpmap
+			for i := 0; i < n; i++ {
+				dmb.Set(gen(rng))
+			}
+			var rest []int32
+			var seen dumpmap
+			for i := 0; i < n/2+1; i++ {
+				if id := gen(rng); !dmb.Has(id) && !seen.Has(id) {
+					seen.Set(id)
+					rest = append(rest, id)
+				}
+			}
+			for bname, build := range builders {
+				mp := build(dmb, rest)
+				checkProps(t, rng, gen, dmb, mp, gname+"/"+bname)
+			}
+		}
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	var dmb dumpmap
+	bm := &bitmap3.Bitmap{}
+	for i := 0; i < 5000; i++ {
+		v := rng.Int31n(1 << 18)
+		dmb.Set(v)
+		bm.Set(v)
+	}
+	mt := bitmap3.Materialize(bm)
+	assert.Equal(t, dmb.Count(), mt.Count())
+	// materialized is a snapshot
+	bm.Set(1<<18 + 1)
+	assert.False(t, mt.Has(1<<18+1))
+	equal(t, dmb, mt)
+	assert.Equal(t, uint32(0), bitmap3.Materialize(bitmap3.NullBitmap{}).Count())
+}
@@ -67,3 +67,11 @@ func (s *Small) Set(id int32) {
 	s.Data[ix] = id
 	s.Size++
 }
+
+func (s *Small) Has(id int32) bool {
+	if s.SmallImpl == nil {
+		return false
+	}
+	ix := searchSparse32(s.Data[:s.Size], id)
+	return ix < int(s.Size) && s.Data[ix] == id
+}
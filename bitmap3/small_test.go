@@ -0,0 +1,76 @@
+package bitmap3_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+func TestSmall_Has(t *testing.T) {
+	var p uintptr
+	s := bitmap3.GetSmall(&p)
+	require.False(t, s.Has(1))
+
+	ids := []int32{5, 100, 1, 77, 3000, 42, 8, 64, 9, 1000}
+	for _, id := range ids {
+		s.Set(id)
+	}
+	for _, id := range ids {
+		require.True(t, s.Has(id), "id %d", id)
+	}
+	for _, id := range []int32{0, 2, 43, 99, 101, 5000} {
+		require.False(t, s.Has(id), "id %d", id)
+	}
+}
+
+type idGen struct {
+	name string
+	// max is count of distinct ids test takes from gen
+	max int
+	gen func() int32
+}
+
+// mutGens are generators of ported bitmap2 tests: sparse, dense and
+// clustered ids.
+func mutGens(rng *rand.Rand) []idGen {
+	return []idGen{
+		{"sparse", 200, func() int32 { return rng.Int31n(1 << 20) }},
+		{"1<<7", 120, func() int32 { return rng.Int31n(1 << 7) }},
+		{"1<<8", 200, func() int32 { return rng.Int31n(1 << 8) }},
+		{"1<<9", 200, func() int32 { return rng.Int31n(1 << 9) }},
+		{"clustered", 200, func() int32 {
+			n := rng.Int31n(1 << 10)
+			return n%256 + n/256*911
+		}},
+	}
+}
+
+func TestSmall(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, g := range mutGens(rng) {
+		for k := 1; k <= g.max; k += k/4 + 1 {
+			var p uintptr
+			s := bitmap3.GetSmall(&p)
+			var dmb dumpmap
+			for dmb.Count() < uint32(k) {
+				v := g.gen()
+				s.Set(v)
+				dmb.Set(v)
+			}
+			require.Equal(t, dmb.Count(), s.GetSize(), "%s k %d", g.name, k)
+			require.Equal(t, dmb.Array(), append([]int32{}, s.Data[:s.Size]...), "%s k %d", g.name, k)
+			for i := 0; i < 100; i++ {
+				v := g.gen()
+				require.Equal(t, dmb.Has(v), s.Has(v), "%s k %d id %d", g.name, k, v)
+			}
+
+			// copy keeps ids and has room for a few more without growth
+			s.ForceAlloc()
+			require.Equal(t, dmb.Array(), append([]int32{}, s.Data[:s.Size]...), "%s k %d", g.name, k)
+			require.True(t, s.Cap > s.Size)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package bitmap3
+
+// ThresholdBitmap contains ids present in at least Min of Maps.
+type ThresholdBitmap struct {
+	Maps []IBitmap
+	Min  int
+	L2   [384]uint64
+
+	LastSpan  int32
+	LastBlock uint64
+
+	words []uint64
+	ge    []uint64
+}
+
+// NewThresholdBitmap returns bitmap of ids present in at least min of maps.
+// It degrades to OrBitmap for min <= 1 and to AndBitmap for min == len(maps).
+func NewThresholdBitmap(maps []IBitmap, min int) IBitmap {
+	switch {
+	case min <= 1:
+		return NewOrBitmap(maps)
+	case min == len(maps):
+		return NewAndBitmap(maps)
+	case min > len(maps):
+		return NullBitmap{}
+	}
+	bm := &ThresholdBitmap{
+		Maps:     maps,
+		Min:      min,
+		LastSpan: -1,
+		words:    make([]uint64, len(maps)),
+		ge:       make([]uint64, min+1),
+	}
+	for i := range bm.L2 {
+		for j, m := range maps {
+			bm.words[j] = m.GetL2()[i]
+		}
+		bm.L2[i] = bm.atLeast()
+	}
+	return bm
+}
+
+// atLeast returns bits set in at least Min of words. ge[j] accumulates
+// bits seen in at least j words so far.
+func (bm *ThresholdBitmap) atLeast() uint64 {
+	ge := bm.ge
+	ge[0] = ^uint64(0)
+	for j := 1; j < len(ge); j++ {
+		ge[j] = 0
+	}
+	for k, w := range bm.words {
+		if w == 0 {
+			continue
+		}
+		top := k + 1
+		if top > bm.Min {
+			top = bm.Min
+		}
+		for j := top; j > 0; j-- {
+			ge[j] |= ge[j-1] & w
+		}
+	}
+	return ge[bm.Min]
+}
+
+func (bm *ThresholdBitmap) block(span int32) uint64 {
+	for j, m := range bm.Maps {
+		bm.words[j] = m.GetBlock(span)
+	}
+	return bm.atLeast()
+}
+
+func (bm *ThresholdBitmap) LoopBlock(f func(int32, uint64) bool) {
+	var l2u Unrolled
+	for l2ix := int32(len(bm.L2) - 1); l2ix >= 0; l2ix-- {
+		l2v := bm.L2[l2ix]
+		if l2v == 0 {
+			continue
+		}
+		for _, l3ix := range Unroll(l2v, l2ix*64, &l2u) {
+			l3ixb := l3ix * 64
+			if l3v := bm.block(l3ixb); l3v != 0 && !f(l3ixb, l3v) {
+				return
+			}
+		}
+	}
+}
+
+func (bm *ThresholdBitmap) GetL2() *[384]uint64 {
+	return &bm.L2
+}
+
+func (bm *ThresholdBitmap) GetBlock(span int32) uint64 {
+	if span == bm.LastSpan {
+		return bm.LastBlock
+	}
+	if !Has(bm.L2[:], span/64) {
+		return 0
+	}
+	bm.LastSpan = span
+	bm.LastBlock = bm.block(span)
+	return bm.LastBlock
+}
+
+func (bm *ThresholdBitmap) Has(ix int32) bool {
+	bl := bm.GetBlock(ix &^ 63)
+	b := uint64(1) << uint32(ix&63)
+	return bl&b != 0
+}
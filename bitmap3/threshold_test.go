@@ -0,0 +1,55 @@
+package bitmap3_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+func thresholdDumb(dmb []dumpmap, min int) dumpmap {
+	cnt := make(map[int32]int)
+	for _, m := range dmb {
+		for k := range m.m {
+			cnt[k]++
+		}
+	}
+	var res dumpmap
+	for k, c := range cnt {
+		if c >= min {
+			res.Set(k)
+		}
+	}
+	return res
+}
+
+func TestThresholdBitmap(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, span := range []int32{512, 1 << 16, 1 << 20} {
+		for k := 2; k < 7; k++ {
+			maps := make([]bitmap3.Bitmap, k)
+			dumb := make([]dumpmap, k)
+			imaps := make([]bitmap3.IBitmap, k)
+			for j := 0; j < k; j++ {
+				for i := 0; i < 3000; i++ {
+					v := rng.Int31n(span)
+					maps[j].Set(v)
+					dumb[j].Set(v)
+				}
+				imaps[j] = &maps[j]
+			}
+			for min := 1; min <= k; min++ {
+				mp := bitmap3.NewThresholdBitmap(imaps, min)
+				dmb := thresholdDumb(dumb, min)
+				equal(t, dmb, mp)
+				for i := 0; i < 200; i++ {
+					v := rng.Int31n(span)
+					assert.Equal(t, dmb.Has(v), mp.Has(v), "id %d min %d", v, min)
+				}
+			}
+			assert.Equal(t, bitmap3.NullBitmap{}, bitmap3.NewThresholdBitmap(imaps, k+1))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheGen is bumped by every write under globMutex. Response is cached
+// together with generation it was computed at, and is served only while
+// generation is the same, so no result survives completed write.
+var CacheGen uint64
+
+func BumpCacheGen() {
+	atomic.AddUint64(&CacheGen, 1)
+}
+
+type cacheEntry struct {
+	key  string
+	gen  uint64
+	body []byte
+}
+
+type ResponseCache struct {
+	sync.Mutex
+	max   int
+	lru   list.List
+	items map[string]*list.Element
+
+	Hits      uint64
+	Misses    uint64
+	Stale     uint64
+	Evictions uint64
+}
+
+var QueryCache ResponseCache
+
+func (c *ResponseCache) Init(max int) {
+	c.max = max
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// Get returns body cached for key at generation gen.
+func (c *ResponseCache) Get(key string, gen uint64) ([]byte, bool) {
+	if c.max <= 0 {
+		return nil, false
+	}
+	c.Lock()
+	defer c.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.Misses++
+		return nil, false
+	}
+	ent := el.Value.(*cacheEntry)
+	if ent.gen != gen {
+		c.Stale++
+		c.Misses++
+		c.lru.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.Hits++
+	c.lru.MoveToFront(el)
+	return ent.body, true
+}
+
+func (c *ResponseCache) Put(key string, gen uint64, body []byte) {
+	if c.max <= 0 {
+		return
+	}
+	body = append([]byte(nil), body...)
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.items[key]; ok {
+		ent := el.Value.(*cacheEntry)
+		if ent.gen > gen {
+			return
+		}
+		ent.gen, ent.body = gen, body
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, gen: gen, body: body})
+	for c.lru.Len() > c.max {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.items, el.Value.(*cacheEntry).key)
+		c.Evictions++
+	}
+}
+
+func (c *ResponseCache) StatJSON() []byte {
+	c.Lock()
+	defer c.Unlock()
+	b := []byte(`{"size":`)
+	b = strconv.AppendInt(b, int64(c.lru.Len()), 10)
+	b = append(b, `,"max":`...)
+	b = strconv.AppendInt(b, int64(c.max), 10)
+	b = append(b, `,"hits":`...)
+	b = strconv.AppendUint(b, c.Hits, 10)
+	b = append(b, `,"misses":`...)
+	b = strconv.AppendUint(b, c.Misses, 10)
+	b = append(b, `,"stale":`...)
+	b = strconv.AppendUint(b, c.Stale, 10)
+	b = append(b, `,"evictions":`...)
+	b = strconv.AppendUint(b, c.Evictions, 10)
+	b = append(b, `,"gen":`...)
+	b = strconv.AppendUint(b, atomic.LoadUint64(&CacheGen), 10)
+	b = append(b, '}')
+	return b
+}
+
+// cacheKey normalizes query: arguments are sorted and query_id is dropped.
+func cacheKey(path string, args []kv) string {
+	sorted := make([]kv, 0, len(args))
+	for _, a := range args {
+		if a.k != "query_id" {
+			sorted = append(sorted, a)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].k != sorted[j].k {
+			return sorted[i].k < sorted[j].k
+		}
+		return sorted[i].v < sorted[j].v
+	})
+	var sb strings.Builder
+	sb.WriteString(path)
+	for i, a := range sorted {
+		if i == 0 {
+			sb.WriteByte('?')
+		} else {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(a.k)
+		sb.WriteByte('=')
+		sb.WriteString(a.v)
+	}
+	return sb.String()
+}
+
+// cachedGet serves request from cache or calls do and remembers its
+// successful response.
+func cachedGet(ctx *Request, path string, do func(*Request)) {
+	if QueryCache.max <= 0 {
+		do(ctx)
+		return
+	}
+	key := cacheKey(path, ctx.Args)
+	gen := atomic.LoadUint64(&CacheGen)
+	if body, ok := QueryCache.Get(key, gen); ok {
+		ctx.SetStatusCode(200)
+		ctx.SetBody(body)
+		return
+	}
+	ctx.CacheKey = key
+	ctx.CacheGen = gen
+	do(ctx)
+}
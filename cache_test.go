@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache(t *testing.T) {
+	var c ResponseCache
+	c.Init(2)
+
+	c.Put("a", 1, []byte("A"))
+	b, ok := c.Get("a", 1)
+	require.True(t, ok)
+	require.Equal(t, "A", string(b))
+
+	// entry of previous generation is dropped
+	_, ok = c.Get("a", 2)
+	require.False(t, ok)
+	_, ok = c.Get("a", 1)
+	require.False(t, ok)
+	require.Equal(t, uint64(1), c.Stale)
+
+	// late Put of older generation doesn't overwrite newer
+	c.Put("a", 3, []byte("A3"))
+	c.Put("a", 2, []byte("A2"))
+	b, ok = c.Get("a", 3)
+	require.True(t, ok)
+	require.Equal(t, "A3", string(b))
+
+	// body is copied
+	body := []byte("B")
+	c.Put("b", 3, body)
+	body[0] = 'X'
+	b, _ = c.Get("b", 3)
+	require.Equal(t, "B", string(b))
+
+	// least recently used is evicted
+	c.Get("a", 3)
+	c.Put("c", 3, []byte("C"))
+	_, ok = c.Get("b", 3)
+	require.False(t, ok)
+	_, ok = c.Get("a", 3)
+	require.True(t, ok)
+	require.Equal(t, uint64(1), c.Evictions)
+
+	var off ResponseCache
+	off.Init(0)
+	off.Put("a", 1, []byte("A"))
+	_, ok = off.Get("a", 1)
+	require.False(t, ok)
+}
+
+func TestCacheKey(t *testing.T) {
+	key := cacheKey("/accounts/filter/", []kv{{"sex_eq", "m"}, {"limit", "10"}, {"query_id", "1"}})
+	require.Equal(t, "/accounts/filter/?limit=10&sex_eq=m", key)
+	// order of arguments and query_id don't matter
+	require.Equal(t, key, cacheKey("/accounts/filter/", []kv{{"query_id", "2"}, {"limit", "10"}, {"sex_eq", "m"}}))
+	require.NotEqual(t, key, cacheKey("/accounts/filter/", []kv{{"limit", "10"}, {"sex_eq", "f"}}))
+	require.NotEqual(t, key, cacheKey("/accounts/group/", []kv{{"limit", "10"}, {"sex_eq", "m"}}))
+	require.Equal(t, "/accounts/group/", cacheKey("/accounts/group/", []kv{{"query_id", "3"}}))
+}
+
+// TestCachedGet checks that response is invalidated by write and that
+// cached body is encoded per request: cache keeps it uncompressed, so
+// Accept-Encoding is not part of key.
+func TestCachedGet(t *testing.T) {
+	QueryCache.Init(10)
+	defer QueryCache.Init(0)
+
+	calls := 0
+	serve := func(r *Request) {
+		cachedGet(r, r.Path, func(r *Request) {
+			calls++
+			r.SetStatusCode(200)
+			r.SetBody(bytes.Repeat([]byte(strconv.Itoa(calls)), 2000))
+		})
+	}
+	get := func(args, accept string) (string, string) {
+		raw := "GET /accounts/filter/?" + args + " HTTP/1.1\r\n"
+		if accept != "" {
+			raw += "Accept-Encoding: " + accept + "\r\n"
+		}
+		resp, b := roundTrip(t, raw+"\r\n", serve)
+		enc := resp.Header.Get("Content-Encoding")
+		if enc == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(b))
+			require.NoError(t, err)
+			b, err = ioutil.ReadAll(zr)
+			require.NoError(t, err)
+		}
+		return string(b[:1]), enc
+	}
+
+	body, enc := get("sex_eq=m&limit=1&query_id=1", "gzip")
+	require.Equal(t, "1", body)
+	require.Equal(t, "gzip", enc)
+	body, enc = get("limit=1&sex_eq=m&query_id=2", "")
+	require.Equal(t, "1", body)
+	require.Equal(t, "", enc)
+	require.Equal(t, 1, calls)
+
+	BumpCacheGen()
+	body, _ = get("limit=1&sex_eq=m", "gzip")
+	require.Equal(t, "2", body)
+	body, _ = get("limit=1&sex_eq=f", "gzip")
+	require.Equal(t, "3", body)
+	require.Equal(t, 3, calls)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"strconv"
+	"sync"
+)
+
+const (
+	EncodingGzip    = 1
+	EncodingDeflate = 2
+)
+
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		w, err := gzip.NewWriterLevel(nil, *compressLevel)
+		if err != nil {
+			w = gzip.NewWriter(nil)
+		}
+		return w
+	},
+}
+
+var zlibPool = sync.Pool{
+	New: func() interface{} {
+		w, err := zlib.NewWriterLevel(nil, *compressLevel)
+		if err != nil {
+			w = zlib.NewWriter(nil)
+		}
+		return w
+	},
+}
+
+var hdrAcceptEncoding = []byte("Accept-Encoding")
+
+// ParseAcceptEncoding returns mask of supported encodings acceptable by client.
+// "*" stands for gzip unless gzip is explicitly refused with q=0.
+func ParseAcceptEncoding(v []byte) uint8 {
+	var res, refused uint8
+	var star bool
+	for len(v) > 0 {
+		var tok []byte
+		if ix := bytes.IndexByte(v, ','); ix == -1 {
+			tok, v = v, nil
+		} else {
+			tok, v = v[:ix], v[ix+1:]
+		}
+		name := tok
+		q := 1.0
+		if ix := bytes.IndexByte(tok, ';'); ix != -1 {
+			name = tok[:ix]
+			param := bytes.TrimSpace(tok[ix+1:])
+			if bytes.HasPrefix(param, []byte("q=")) {
+				var err error
+				if q, err = strconv.ParseFloat(b2s(param[2:]), 64); err != nil {
+					continue
+				}
+			}
+		}
+		name = bytes.TrimSpace(name)
+		var enc uint8
+		switch {
+		case bytes.EqualFold(name, []byte("gzip")):
+			enc = EncodingGzip
+		case bytes.EqualFold(name, []byte("deflate")):
+			enc = EncodingDeflate
+		case bytes.Equal(name, []byte("*")):
+			star = star || q > 0
+			continue
+		}
+		if q > 0 {
+			res |= enc
+		} else {
+			refused |= enc
+		}
+	}
+	if star && refused&EncodingGzip == 0 {
+		res |= EncodingGzip
+	}
+	return res
+}
+
+// compressBody compresses b if client accepts it and body is large enough.
+// Result is valid until next request on r.
+func (r *Request) compressBody(b []byte) ([]byte, string) {
+	if !*compress || r.AcceptEncoding == 0 || len(b) < *compressMin {
+		return b, ""
+	}
+	if r.Zbuf == nil {
+		r.Zbuf = new(bytes.Buffer)
+	}
+	r.Zbuf.Reset()
+	if r.AcceptEncoding&EncodingGzip != 0 {
+		w := gzipPool.Get().(*gzip.Writer)
+		defer gzipPool.Put(w)
+		w.Reset(r.Zbuf)
+		if _, err := w.Write(b); err != nil || w.Close() != nil {
+			return b, ""
+		}
+		return r.Zbuf.Bytes(), "gzip"
+	}
+	w := zlibPool.Get().(*zlib.Writer)
+	defer zlibPool.Put(w)
+	w.Reset(r.Zbuf)
+	if _, err := w.Write(b); err != nil || w.Close() != nil {
+		return b, ""
+	}
+	return r.Zbuf.Bytes(), "deflate"
+}
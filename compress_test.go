@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	cases := []struct {
+		hdr string
+		res uint8
+	}{
+		{"", 0},
+		{"gzip", EncodingGzip},
+		{" GZip ", EncodingGzip},
+		{"deflate", EncodingDeflate},
+		{"gzip, deflate, br", EncodingGzip | EncodingDeflate},
+		{"br", 0},
+		{"identity", 0},
+		{"identity;q=0", 0},
+		{"identity;q=0, gzip", EncodingGzip},
+		{"*", EncodingGzip},
+		{"*;q=0", 0},
+		{"gzip;q=0, deflate", EncodingDeflate},
+		{"gzip; q=0.5, deflate;q=0.0", EncodingGzip},
+		{"gzip;q=0.001", EncodingGzip},
+		{"gzip;q=bad", 0},
+		{"deflate;level=1", EncodingDeflate},
+		{"gzip;q=0, *", 0},
+		{"*, gzip;q=0", 0},
+		{"gzip;q=0, deflate, *", EncodingDeflate},
+		{"deflate;q=0, *", EncodingGzip},
+		{"*;q=0, deflate", EncodingDeflate},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.res, ParseAcceptEncoding([]byte(c.hdr)), "%q", c.hdr)
+	}
+}
+
+// roundTrip parses raw request and serves it over pipe.
+// It returns response and its raw body.
+func roundTrip(t *testing.T, raw string, serve func(*Request)) (*http.Response, []byte) {
+	srv, cli := net.Pipe()
+	defer cli.Close()
+	go func() {
+		defer srv.Close()
+		var r Request
+		r.ResetConn(srv)
+		if err := r.Parse(); err != nil {
+			return
+		}
+		serve(&r)
+	}()
+	_, err := cli.Write([]byte(raw))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(cli), nil)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, b
+}
+
+func TestCompressedResponse(t *testing.T) {
+	big := bytes.Repeat([]byte(`{"id":1,"email":"a@b.c"},`), 200)
+	small := []byte(`{"accounts":[]}`)
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"":        func(r io.Reader) (io.Reader, error) { return r, nil },
+	}
+	cases := []struct {
+		accept   string
+		body     []byte
+		encoding string
+	}{
+		{"", big, ""},
+		{"gzip, deflate", big, "gzip"},
+		{"deflate", big, "deflate"},
+		{"gzip;q=0, deflate", big, "deflate"},
+		{"identity", big, ""},
+		{"gzip", small, ""},
+		{"gzip", nil, ""},
+		{"*, gzip;q=0", big, ""},
+	}
+	for _, c := range cases {
+		raw := "GET /accounts/filter/ HTTP/1.1\r\n"
+		if c.accept != "" {
+			raw += "Accept-Encoding: " + c.accept + "\r\n"
+		}
+		resp, b := roundTrip(t, raw+"\r\n", func(r *Request) {
+			r.SetStatusCode(200)
+			r.SetBody(c.body)
+		})
+		require.Equal(t, c.encoding, resp.Header.Get("Content-Encoding"), c.accept)
+		require.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"), c.accept)
+		rd, err := decoders[c.encoding](bytes.NewReader(b))
+		require.NoError(t, err)
+		got, err := ioutil.ReadAll(rd)
+		require.NoError(t, err)
+		require.Equal(t, string(c.body), string(got), c.accept)
+		if c.encoding != "" {
+			require.True(t, resp.ContentLength < int64(len(c.body)))
+		}
+	}
+}
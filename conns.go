@@ -0,0 +1,182 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"log"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	connFree = iota
+	connArmed
+	connBusy
+)
+
+// conn is a state of accepted connection between epoll wakeups.
+// Worker owns connection while it is connBusy. Reaper may steal only
+// armed connection whose deadline is passed.
+type conn struct {
+	state    uint32
+	gen      uint32
+	deadline int64
+	req      *Request
+}
+
+var conns []conn
+var connCount int32
+var connMaxFd int32
+
+var requestPool = sync.Pool{
+	New: func() interface{} { return new(Request) },
+}
+
+var resp503 = []byte("HTTP/1.1 503 Service Unavailable\r\n" +
+	"Server: fake-server v0.1\r\n" +
+	"Connection: close\r\n" +
+	"Content-Length: 0\r\n\r\n")
+
+func initConns() {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		log.Fatal(err)
+	}
+	n := lim.Cur
+	if n > 1<<20 {
+		n = 1 << 20
+	}
+	if n < 1024 {
+		n = 1024
+	}
+	conns = make([]conn, n)
+	go connReaper()
+}
+
+// acceptConn registers new connection. It returns nil if connection
+// limit is reached, in which case client receives 503 and fd is closed.
+// Connection is returned busy, caller should arm it.
+func acceptConn(fd int) *conn {
+	n := atomic.AddInt32(&connCount, 1)
+	if int(n) > *maxConns || fd >= len(conns) {
+		atomic.AddInt32(&connCount, -1)
+		File(fd).Write(resp503)
+		File(fd).Close()
+		return nil
+	}
+	if *writeTimeout > 0 {
+		tv := syscall.NsecToTimeval(int64(*writeTimeout))
+		if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_SNDTIMEO, &tv); err != nil {
+			logf("set write timeout: %v", err)
+			atomic.AddInt32(&connCount, -1)
+			File(fd).Close()
+			return nil
+		}
+	}
+	if int32(fd) > atomic.LoadInt32(&connMaxFd) {
+		atomic.StoreInt32(&connMaxFd, int32(fd))
+	}
+	c := &conns[fd]
+	c.req = nil
+	atomic.AddUint32(&c.gen, 1)
+	atomic.StoreUint32(&c.state, connBusy)
+	return c
+}
+
+func connDeadline(from int64, timeout time.Duration) int64 {
+	if timeout <= 0 {
+		return math.MaxInt64
+	}
+	return from + int64(timeout)
+}
+
+// takeConn grabs connection for the worker which got epoll event.
+// Event may come before worker which armed connection published it,
+// then we wait for it.
+func takeConn(fd int, gen uint32) *conn {
+	if fd >= len(conns) {
+		return nil
+	}
+	c := &conns[fd]
+	for {
+		if atomic.LoadUint32(&c.gen) != gen {
+			return nil
+		}
+		if atomic.CompareAndSwapUint32(&c.state, connArmed, connBusy) {
+			return c
+		}
+		if atomic.LoadUint32(&c.state) != connBusy {
+			return nil
+		}
+		runtime.Gosched()
+	}
+}
+
+// arm returns connection to epoll (adds it if add is set). Connection is
+// published to reaper only after it is registered, so reaper could not
+// close fd under epoll_ctl. It returns false if connection should be closed
+// instead: its deadline is already passed or registration failed.
+func (c *conn) arm(epollfd int, fd File, add bool) bool {
+	now := time.Now().UnixNano()
+	var deadline int64
+	if c.req != nil {
+		deadline = connDeadline(c.req.Start, *readTimeout)
+	} else {
+		deadline = connDeadline(now, *idleTimeout)
+	}
+	if deadline <= now {
+		logf("connection %d timed out", fd)
+		return false
+	}
+	atomic.StoreInt64(&c.deadline, deadline)
+	if err := fd.addToEpoll(epollfd, add, atomic.LoadUint32(&c.gen)); err != nil {
+		logf("epoll_ctl %d: %v", fd, err)
+		return false
+	}
+	atomic.StoreUint32(&c.state, connArmed)
+	return true
+}
+
+func (c *conn) close(fd File) {
+	if c.req != nil {
+		requestPool.Put(c.req)
+		c.req = nil
+	}
+	// state should be free before fd is closed: acceptor may reuse fd
+	// number immediately.
+	atomic.StoreUint32(&c.state, connFree)
+	fd.Close()
+	atomic.AddInt32(&connCount, -1)
+}
+
+func connReaper() {
+	period := time.Second
+	for _, t := range []time.Duration{*idleTimeout, *readTimeout} {
+		if t > 0 && t/4 < period {
+			period = t / 4
+		}
+	}
+	if period < 10*time.Millisecond {
+		period = 10 * time.Millisecond
+	}
+	for range time.Tick(period) {
+		now := time.Now().UnixNano()
+		maxFd := int(atomic.LoadInt32(&connMaxFd))
+		for fd := 0; fd <= maxFd && fd < len(conns); fd++ {
+			c := &conns[fd]
+			if atomic.LoadUint32(&c.state) != connArmed ||
+				atomic.LoadInt64(&c.deadline) > now {
+				continue
+			}
+			if atomic.CompareAndSwapUint32(&c.state, connArmed, connBusy) {
+				logf("reap connection %d", fd)
+				c.close(File(fd))
+			}
+		}
+	}
+}
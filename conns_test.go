@@ -0,0 +1,148 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testMaxConns = 4
+
+var epollOnce sync.Once
+var epollAddr string
+
+// startEpoll runs epoll server once per test binary with short timeouts.
+func startEpoll(t *testing.T) string {
+	epollOnce.Do(func() {
+		*idleTimeout = 600 * time.Millisecond
+		*readTimeout = 300 * time.Millisecond
+		*maxConns = testMaxConns
+		*workers = 2
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		epollAddr = "127.0.0.1:" + strconv.Itoa(port)
+		go Acceptor(port)
+		for i := 0; i < 100; i++ {
+			if c, err := net.Dial("tcp", epollAddr); err == nil {
+				c.Close()
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	// previous tests' connections should be noticed closed
+	for i := 0; i < 100 && atomic.LoadInt32(&connCount) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Zero(t, atomic.LoadInt32(&connCount))
+	return epollAddr
+}
+
+func readResp(t *testing.T, rd *bufio.Reader) (int, string) {
+	resp, err := http.ReadResponse(rd, nil)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// waitClosed checks server closes connection within d without response.
+func waitClosed(t *testing.T, c net.Conn, d time.Duration) {
+	c.SetReadDeadline(time.Now().Add(d))
+	n, err := c.Read(make([]byte, 1))
+	require.Equal(t, 0, n)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestEpoll_Partial(t *testing.T) {
+	addr := startEpoll(t)
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	rd := bufio.NewReader(c)
+	parts := []string{"GET /te", "st HTTP/1.1\r\nHost: loc", "alhost\r\n", "\r\n"}
+	for i := 0; i < 2; i++ {
+		for _, p := range parts {
+			_, err = c.Write([]byte(p))
+			require.NoError(t, err)
+			time.Sleep(20 * time.Millisecond)
+		}
+		code, body := readResp(t, rd)
+		require.Equal(t, 200, code)
+		require.Equal(t, "{}", body)
+	}
+}
+
+func TestEpoll_ReadTimeout(t *testing.T) {
+	addr := startEpoll(t)
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	start := time.Now()
+	_, err = c.Write([]byte("GET /test HTTP/1.1\r\n"))
+	require.NoError(t, err)
+	// more data doesn't extend deadline of request, as idle timeout would
+	time.Sleep(150 * time.Millisecond)
+	_, err = c.Write([]byte("X-A: b\r\n"))
+	require.NoError(t, err)
+	waitClosed(t, c, 2*time.Second)
+	require.True(t, time.Since(start) < 550*time.Millisecond)
+}
+
+func TestEpoll_IdleTimeout(t *testing.T) {
+	addr := startEpoll(t)
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	rd := bufio.NewReader(c)
+	_, err = c.Write([]byte("GET /test HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	code, _ := readResp(t, rd)
+	require.Equal(t, 200, code)
+	start := time.Now()
+	waitClosed(t, c, 2*time.Second)
+	require.True(t, time.Since(start) >= 500*time.Millisecond)
+}
+
+func TestEpoll_MaxConns(t *testing.T) {
+	addr := startEpoll(t)
+	var open []net.Conn
+	defer func() {
+		for _, c := range open {
+			c.Close()
+		}
+	}()
+	for i := 0; i < testMaxConns; i++ {
+		c, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		open = append(open, c)
+		_, err = c.Write([]byte("GET /test HTTP/1.1\r\n\r\n"))
+		require.NoError(t, err)
+		code, _ := readResp(t, bufio.NewReader(c))
+		require.Equal(t, 200, code)
+	}
+
+	c, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer c.Close()
+	code, _ := readResp(t, bufio.NewReader(c))
+	require.Equal(t, 503, code)
+}
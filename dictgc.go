@@ -0,0 +1,171 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// DictStat is number of strings reclaimed from each dictionary.
+type DictStat struct {
+	Email    int `json:"email"`
+	Phone    int `json:"phone"`
+	Domain   int `json:"domain"`
+	Code     int `json:"code"`
+	Fname    int `json:"fname"`
+	Sname    int `json:"sname"`
+	City     int `json:"city"`
+	Country  int `json:"country"`
+	Interest int `json:"interest"`
+}
+
+// dropped returns number of strings remap drops.
+func dropped(remap []uint32) int {
+	n := 0
+	for _, ix := range remap[1:] {
+		if ix == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// remapIx returns new id of dictionary string ix, false if it is dropped.
+func remapIx(remap []uint32, ix int) (int, bool) {
+	if ix == 0 {
+		return 0, true
+	}
+	if ix >= len(remap) || remap[ix] == 0 {
+		return 0, false
+	}
+	return int(remap[ix]), true
+}
+
+// remapInterests moves counters of interest groups indexed by ix-1.
+func remapInterests(row *[100]uint32, remap []uint32) {
+	var res [100]uint32
+	for i, cnt := range row {
+		if ix, ok := remapIx(remap, i+1); ok {
+			res[ix-1] = cnt
+		}
+	}
+	*row = res
+}
+
+// CompactDicts drops dictionary strings no account uses anymore and
+// renumbers the rest, fixing Account fields, interest masks, search indexes
+// and group counters. It must be called under globMutex.
+// Remaps, compacted tables and group counters are built while dictMutex is
+// held shared, so GET requests run meanwhile. They block only while new
+// tables are installed and account fields are rewritten.
+func CompactDicts() DictStat {
+	var applies []func()
+	prepare := func(remap []uint32, apply func()) []uint32 {
+		applies = append(applies, apply)
+		return remap
+	}
+
+	dictMutex.RLock()
+	email := prepare(EmailIndex.Compact())
+	applies = append(applies, EmailNgrams.Remap(email), EmailSorted.Remap(email))
+	phone := prepare(PhoneIndex.Compact())
+	domain := prepare(DomainsStrings.Compact())
+	code := prepare(PhoneCodesStrings.Compact())
+	fname := prepare(FnameStrings.Compact())
+	applies = append(applies, FnameNgrams.Remap(fname))
+	sname := prepare(SnameStrings.Compact())
+	applies = append(applies, SnameNgrams.Remap(sname))
+	city := prepare(CityStrings.Compact())
+	country := prepare(CountryStrings.Compact())
+	interest := prepare(InterestStrings.Compact())
+
+	var cityGroups [1000][6]uint32
+	for i := range CityGroups {
+		if ix, ok := remapIx(city, i); ok {
+			cityGroups[ix] = CityGroups[i]
+		}
+	}
+	var countryGroups [100][6]uint32
+	var interestCountryGroups [100][100]uint32
+	for i := range CountryGroups {
+		if ix, ok := remapIx(country, i); ok {
+			countryGroups[ix] = CountryGroups[i]
+			interestCountryGroups[ix] = InterestCountryGroups[i]
+			remapInterests(&interestCountryGroups[ix], interest)
+		}
+	}
+	interestJoinedGroups := InterestJoinedGroups
+	for i := range interestJoinedGroups {
+		remapInterests(&interestJoinedGroups[i], interest)
+	}
+	interestBirthGroups := InterestBirthGroups
+	for i := range interestBirthGroups {
+		remapInterests(&interestBirthGroups[i], interest)
+	}
+	dictMutex.RUnlock()
+
+	dictMutex.Lock()
+	defer dictMutex.Unlock()
+	for _, apply := range applies {
+		apply()
+	}
+	for uid := int32(1); uid < MaxId; uid++ {
+		acc := HasAccount(uid)
+		if acc == nil {
+			continue
+		}
+		acc.Email = email[acc.Email]
+		acc.Phone = phone[acc.Phone]
+		acc.Domain = uint8(domain[acc.Domain])
+		acc.Code = uint8(code[acc.Code])
+		acc.Fname = uint8(fname[acc.Fname])
+		acc.Sname = uint16(sname[acc.Sname])
+		acc.City = uint16(city[acc.City])
+		acc.Country = uint8(country[acc.Country])
+		var mask InterestMask
+		GetInterest(uid).Unroll(func(ix int32) {
+			mask.Set(uint8(interest[ix]))
+		})
+		SetInterests(uid, mask)
+		SetSmallAccount(uid, acc.SmallAccount())
+	}
+	CityGroups = cityGroups
+	CountryGroups = countryGroups
+	InterestCountryGroups = interestCountryGroups
+	InterestJoinedGroups = interestJoinedGroups
+	InterestBirthGroups = interestBirthGroups
+
+	BumpCacheGen()
+	return DictStat{
+		Email:    dropped(email),
+		Phone:    dropped(phone),
+		Domain:   dropped(domain),
+		Code:     dropped(code),
+		Fname:    dropped(fname),
+		Sname:    dropped(sname),
+		City:     dropped(city),
+		Country:  dropped(country),
+		Interest: dropped(interest),
+	}
+}
+
+func doDictGC(ctx *Request) {
+	globMutex.Lock()
+	st := CompactDicts()
+	globMutex.Unlock()
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.WriteVal(st)
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
+
+// RunDictGC compacts dictionaries every period.
+func RunDictGC(period time.Duration) {
+	for range time.Tick(period) {
+		globMutex.Lock()
+		st := CompactDicts()
+		globMutex.Unlock()
+		log.Printf("dictionaries compacted: %+v", st)
+	}
+}
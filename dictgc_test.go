@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func updateTestAccount(t *testing.T, id int32, fields map[string]interface{}) {
+	body, _ := json.Marshal(fields)
+	code, resp := serve(t, "POST", fmt.Sprintf("/accounts/%d/", id), string(body))
+	require.Equal(t, 202, code, "%d %s: %s", id, body, resp)
+}
+
+// dictTestQueries touch every dictionary by filter and group queries.
+var dictTestQueries = []string{
+	"/accounts/group/?keys=city&order=-1&limit=50",
+	"/accounts/group/?keys=country&order=1&limit=50",
+	"/accounts/group/?keys=city,sex&order=-1&limit=50",
+	"/accounts/group/?keys=country,status&order=-1&limit=50",
+	"/accounts/group/?keys=city&order=-1&limit=50&sex=m&joined=2013",
+	"/accounts/group/?keys=interests&order=-1&limit=50",
+	"/accounts/group/?keys=interests&order=-1&limit=50&country=Тува",
+	"/accounts/group/?keys=interests&order=-1&limit=50&country=Англия",
+	"/accounts/group/?keys=interests&order=-1&limit=50&joined=2014",
+	"/accounts/group/?keys=interests&order=-1&limit=50&birth=1990",
+	"/accounts/group/?keys=country&order=-1&limit=50&interests=хоккей",
+	"/accounts/filter/?city_eq=Омск&limit=50",
+	"/accounts/filter/?city_any=Омск,Москва,Тверь&limit=50",
+	"/accounts/filter/?city_null=1&country_eq=Тува&limit=50",
+	"/accounts/filter/?country_eq=Тува&limit=50",
+	"/accounts/filter/?country_null=0&sex_eq=m&limit=50",
+	"/accounts/filter/?fname_eq=Фёдор&limit=50",
+	"/accounts/filter/?fname_any=Фёдор,Анна,Глеб&limit=50",
+	"/accounts/filter/?sname_eq=Тихонов&limit=50",
+	"/accounts/filter/?sname_starts=Тих&limit=50",
+	"/accounts/filter/?phone_code=977&limit=50",
+	"/accounts/filter/?phone_null=0&limit=50",
+	"/accounts/filter/?email_domain=dict.org&limit=50",
+	"/accounts/filter/?email_gt=dict&email_lt=dicz&limit=50",
+	"/accounts/filter/?email_starts=dict&limit=50",
+	"/accounts/filter/?email_lt=b&limit=50",
+	"/accounts/filter/?interests_contains=хоккей&limit=50",
+	"/accounts/filter/?interests_any=хоккей,кино&limit=50",
+	"/accounts/filter/?interests_none=хоккей,кино&limit=50",
+	"/accounts/filter/?email_contains=dict&limit=50",
+	"/accounts/filter/?fname_contains=fedo&limit=50",
+	"/accounts/filter/?sname_like=tikh%25&limit=50",
+}
+
+type dictSnapshot struct {
+	Bodies    map[string]string
+	Interests map[int32]map[string]bool
+}
+
+func takeDictSnapshot(t *testing.T) dictSnapshot {
+	snap := dictSnapshot{
+		Bodies:    make(map[string]string),
+		Interests: make(map[int32]map[string]bool),
+	}
+	for _, q := range dictTestQueries {
+		u, err := url.Parse(q)
+		require.NoError(t, err)
+		code, body := serve(t, "GET", u.Path+"?"+u.Query().Encode(), "")
+		require.Equal(t, 200, code, "%s: %s", q, body)
+		snap.Bodies[q] = body
+	}
+	for uid := int32(1); uid < MaxId; uid++ {
+		if HasAccount(uid) != nil {
+			snap.Interests[uid] = accInterests(uid)
+		}
+	}
+	return snap
+}
+
+func TestCompactDicts(t *testing.T) {
+	loadFixture(t)
+	// values of first accounts are dropped later, so ids of values of the
+	// second ones are renumbered
+	first := int32(fixtureSize + 200)
+	second := first + 10
+	for i := int32(0); i < 10; i++ {
+		require.Equal(t, 201, newTestAccount(t, first+i, "снег"))
+		updateTestAccount(t, first+i, map[string]interface{}{
+			"email": fmt.Sprintf("gone%d@gone.org", i), "phone": fmt.Sprintf("8(966)%07d", first+i),
+			"fname": "Гость", "sname": "Пропавший", "city": "Тверь", "country": "Атлантида",
+		})
+	}
+	for i := int32(0); i < 10; i++ {
+		require.Equal(t, 201, newTestAccount(t, second+i, "хоккей", "кино"))
+		updateTestAccount(t, second+i, map[string]interface{}{
+			"email": fmt.Sprintf("dict%d@dict.org", i), "phone": fmt.Sprintf("8(977)%07d", second+i),
+			"fname": "Фёдор", "sname": "Тихонов", "city": "Омск", "country": "Тува",
+		})
+	}
+	for i := int32(0); i < 10; i++ {
+		updateTestAccount(t, first+i, map[string]interface{}{
+			"email": fmt.Sprintf("back%d@mail.ru", i), "phone": fmt.Sprintf("8(901)%07d", first+i),
+			"fname": "Анна", "sname": "Петров", "city": "Москва", "country": "Россия",
+			"interests": []string{"спорт"},
+		})
+	}
+	// fixture values leave dictionaries as well
+	updateTestAccount(t, 1, map[string]interface{}{"email": "first@dict.org"})
+
+	oldCity := CityStrings.Find("Омск")
+	before := takeDictSnapshot(t)
+	require.Contains(t, before.Bodies[dictTestQueries[0]], "Омск")
+
+	code, body := serve(t, "POST", "/dict_gc", "")
+	require.Equal(t, 200, code)
+	var st DictStat
+	require.NoError(t, json.Unmarshal([]byte(body), &st), body)
+	require.True(t, st.Email >= 31, body)
+	require.True(t, st.Phone >= 10, body)
+	require.Equal(t, 2, st.Domain, body) // gone.org and test.ru of new accounts
+	require.Equal(t, 1, st.Code, body)
+	require.Equal(t, 1, st.Fname, body)
+	require.Equal(t, 1, st.Sname, body)
+	require.Equal(t, 1, st.City, body)
+	require.Equal(t, 1, st.Country, body)
+	require.Equal(t, 1, st.Interest, body)
+	require.True(t, CityStrings.Find("Омск") < oldCity)
+	require.Zero(t, CityStrings.Find("Тверь"))
+	require.Zero(t, InterestStrings.Find("снег"))
+
+	after := takeDictSnapshot(t)
+	for _, q := range dictTestQueries {
+		require.Equal(t, before.Bodies[q], after.Bodies[q], q)
+	}
+	require.Equal(t, before.Interests, after.Interests)
+
+	// indexes keep working for values inserted after compaction
+	updateTestAccount(t, second, map[string]interface{}{
+		"email": "dict-new@dict.org", "city": "Тверь", "interests": []string{"снег", "хоккей"},
+	})
+	require.Equal(t, []int32{second}, filterIds(t, "city_eq="+url.QueryEscape("Тверь")+"&limit=10"))
+	require.Equal(t, []int32{second}, filterIds(t, "interests_contains="+url.QueryEscape("снег")+"&limit=10"))
+	require.Equal(t, []int32{second}, filterIds(t, "email_starts=dict-&limit=10"))
+	require.Equal(t, []int32{second}, filterIds(t, "email_contains=dict-&limit=10"))
+}
+
+func TestSomeStringsCompact(t *testing.T) {
+	ss := &SomeStrings{Sorted: &SortedIndex{}}
+	ss.Sorted.Table = &ss.StringsTable
+	names := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	for i, name := range names {
+		require.Equal(t, uint32(i+1), ss.Add(name, int32(i+1)))
+	}
+	ss.Unset(2, 2)
+	ss.Unset(4, 4)
+
+	// prepared compaction changes nothing until applied
+	remap, apply := ss.Compact()
+	require.Equal(t, []uint32{0, 1, 0, 2, 0, 3}, remap)
+	for i, name := range names {
+		require.Equal(t, uint32(i+1), ss.Find(name))
+		require.Equal(t, name, ss.GetStr(uint32(i+1)))
+	}
+	require.Len(t, ss.Maps, 5)
+
+	apply()
+	require.Len(t, ss.Arr, 3)
+	require.Len(t, ss.Maps, 3)
+	for _, name := range []string{"beta", "delta"} {
+		require.Zero(t, ss.Find(name))
+	}
+	for old, name := range names {
+		ix := remap[old+1]
+		if ix == 0 {
+			continue
+		}
+		require.Equal(t, ix, ss.Find(name))
+		require.Equal(t, name, ss.GetStr(ix))
+		require.True(t, ss.GetMap(ix).Has(int32(old+1)), name)
+	}
+	var sorted []string
+	ss.Sorted.Ascend("", func(id uint32, s string) bool {
+		sorted = append(sorted, s)
+		return true
+	})
+	require.Equal(t, []string{"alpha", "epsilon", "gamma"}, sorted)
+}
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/binary"
 	"fmt"
 	"reflect"
-	"sort"
 	"strings"
 	"time"
 
@@ -40,7 +38,6 @@ var CurTs int32
 type Account struct {
 	Uid           int32
 	Email         uint32
-	EmailStart    uint32
 	Phone         uint32
 	Domain        uint8
 	Code          uint8
@@ -195,6 +192,9 @@ func CodeFromPhone(p string) string {
 }
 
 var EmailIndex UniqStrings
+
+// EmailSorted orders emails owned by accounts.
+var EmailSorted = SortedIndex{Table: &EmailIndex.StringsTable}
 var PhoneIndex UniqStrings
 
 //var MaleMap = bitmap.Bitmap{}
@@ -222,37 +222,6 @@ var PremiumNotNow = bitmap.Bitmap{}
 var PremiumNull = bitmap.Bitmap{}
 var PremiumNotNull = bitmap.Bitmap{}
 
-var EmailGtIndexes [26]bitmap.Bitmap
-var EmailLtIndexes [26]bitmap.Bitmap
-
-func IndexGtLtEmail(e string, uid int32, set bool) {
-	ch := e[0]
-	// lt
-	start, end := int(ch)-'a', 25
-	if start < 0 {
-		start = 0
-	}
-	for ; start <= end; start++ {
-		if set {
-			EmailLtIndexes[start].Set(uid)
-		} else {
-			EmailLtIndexes[start].Unset(uid)
-		}
-	}
-	// gt
-	start, end = 0, int(ch)-'a'
-	if end > 25 {
-		end = 25
-	}
-	for ; start <= end; start++ {
-		if set {
-			EmailGtIndexes[start].Set(uid)
-		} else {
-			EmailGtIndexes[start].Unset(uid)
-		}
-	}
-}
-
 var BirthYearIndexes [61]bitmap.Bitmap
 
 func GetBirthYear(ts int32) int32 {
@@ -265,12 +234,28 @@ func GetJoinYear(ts int32) int32 {
 	return int32(time.Unix(int64(ts), 0).UTC().Year() - 2011)
 }
 
+var BirthRange = RangeIndex{Shift: 25, Value: func(acc *Account) int32 { return acc.Birth }}
+var JoinedRange = RangeIndex{Shift: 22, Value: func(acc *Account) int32 { return acc.Joined }}
+
+// PremiumStartRange and PremiumFinishRange contain only accounts with premium.
+var PremiumStartRange = RangeIndex{Shift: 21, Value: func(acc *Account) int32 { return acc.PremiumStart }}
+var PremiumFinishRange = RangeIndex{Shift: 21, Value: (*Account).PremiumFinish}
+
+func (acc *Account) PremiumFinish() int32 {
+	return acc.PremiumStart + PremiumLengths[acc.PremiumLength]
+}
+
 var DomainsStrings = SomeStrings{Huge: true}
 var PhoneCodesStrings = SomeStrings{}
 var FnameStrings = SomeStrings{}
 var SnameStrings SomeStrings
-var SnameSorted SnameSorting
-var SnameOnce = NewOnce(SnameSorted.Init)
+
+// SnameSorted orders surnames used by at least one account.
+var SnameSorted = SortedIndex{Table: &SnameStrings.StringsTable}
+
+func init() {
+	SnameStrings.Sorted = &SnameSorted
+}
 var CityStrings SomeStrings
 var CountryStrings SomeStrings
 
@@ -320,91 +305,6 @@ func GetPremiumLength(start, finish int32) uint8 {
 	}
 }
 
-func GetEmailStart(s string) uint32 {
-	if len(s) >= 4 {
-		return binary.BigEndian.Uint32([]byte(s))
-	}
-	return GetEmailPrefix(s)
-}
-
-func GetEmailPrefix(s string) uint32 {
-	l := len(s)
-	r := uint32(0)
-	switch {
-	case l >= 4:
-		r = uint32(s[3])
-		fallthrough
-	case l >= 3:
-		r |= uint32(s[2]) << 8
-		fallthrough
-	case l >= 2:
-		r |= uint32(s[1]) << 16
-		fallthrough
-	case l >= 1:
-		r |= uint32(s[0]) << 24
-	}
-	return r
-}
-
-/*
-func GetEmailLte(s string) uint32 {
-	l := len(s)
-	r := uint32(0)
-	if l >= 4 {
-		r = uint32(s[3])
-	} else {
-		r = 0xff
-	}
-	if l == 3 {
-		r |= uint32(s[2]) << 8
-	} else {
-		r |= 0xff00
-	}
-	if l == 2 {
-		r |= uint32(s[1]) << 16
-	} else {
-		r |= 0xff0000
-	}
-	if l == 1 {
-		r |= uint32(s[0]) << 24
-	} else {
-		r |= 0xff000000
-	}
-	return r
-}
-*/
-
-type SnameSorting struct {
-	Ix  []uint32
-	Str []string
-}
-
-func (s *SnameSorting) Init() {
-	s.Ix = make([]uint32, len(SnameStrings.Arr))
-	s.Str = make([]string, len(SnameStrings.Arr))
-	for i := range s.Ix {
-		s.Ix[i] = uint32(i + 1)
-		s.Str[i] = SnameStrings.GetStr(uint32(i + 1))
-	}
-	sort.Sort(s)
-}
-
-func (s *SnameSorting) Len() int           { return len(s.Ix) }
-func (s *SnameSorting) Less(i, j int) bool { return s.Str[i] < s.Str[j] }
-func (s *SnameSorting) Swap(i, j int) {
-	s.Ix[i], s.Ix[j] = s.Ix[j], s.Ix[i]
-	s.Str[i], s.Str[j] = s.Str[j], s.Str[i]
-}
-
-func (s *SnameSorting) PrefixRange(pref string) (i, j int) {
-	i = sort.Search(len(s.Str), func(i int) bool {
-		return pref <= s.Str[i]
-	})
-	for j = i; j < len(s.Str) && strings.HasPrefix(s.Str[j], pref); j++ {
-	}
-	return
-}
-
 var Likers = make([]uintptr, 1536*1024)
 
 func SureLikers(i int32, f func(*bitmap.Likes)) {
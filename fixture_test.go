@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureSize is larger than rangeRawMax, so wide email ranges are
+// collected into pooled bitmaps.
+const fixtureSize = 6000
+
+var fixtureOnce sync.Once
+
+var (
+	fixtureFnames    = []string{"Иван", "Пётр", "Алексей", "Анна", "Мария", "Ольга"}
+	fixtureSnames    = []string{"Иванов", "Петров", "Сидоров", "Смирнов", "Жуков", "Хабибуллин"}
+	fixtureCities    = []string{"Москва", "Лондон", "Париж", "Рим", "Берлин", ""}
+	fixtureCountries = []string{"Россия", "Англия", "Франция", ""}
+	fixtureInterests = []string{"кино", "музыка", "спорт", "книги", "вино", "пиво",
+		"футбол", "бег", "танцы", "йога", "рок", "джаз"}
+	fixtureDomains  = []string{"mail.ru", "gmail.com", "ya.ru", "inbox.com"}
+	fixtureStatuses = []string{StatusFree, StatusMeeting, StatusComplex}
+)
+
+// loadFixture fills global indexes with deterministic accounts once per
+// test binary. Tests changing accounts should leave them consistent, since
+// other tests check indexes against account fields.
+func loadFixture(t *testing.T) {
+	fixtureOnce.Do(func() {
+		CurTs = 1545834028
+		AgeRanges, _ = ParseAgeRanges(*ageGroups)
+		rng := rand.New(rand.NewSource(41))
+		pick := func(l []string) string { return l[rng.Intn(len(l))] }
+		for id := int32(1); id <= fixtureSize; id++ {
+			var accin AccountIn
+			accin.Id = id
+			local := make([]byte, 2+rng.Intn(6))
+			for i := range local {
+				local[i] = byte('a' + rng.Intn(26))
+			}
+			accin.Email = fmt.Sprintf("%s%d@%s", local, id, pick(fixtureDomains))
+			accin.Fname = pick(fixtureFnames)
+			accin.Sname = pick(fixtureSnames)
+			if rng.Intn(2) == 0 {
+				accin.Phone = fmt.Sprintf("8(9%02d)%07d", rng.Intn(20), id)
+			}
+			// SexMap relies on males having odd uids, as in contest data
+			accin.Sex = "fm"[id%2 : id%2+1]
+			accin.Birth = 300000000 + rng.Int31n(700000000)
+			accin.Joined = 1300000000 + rng.Int31n(200000000)
+			accin.Country = pick(fixtureCountries)
+			accin.City = pick(fixtureCities)
+			accin.Status = pick(fixtureStatuses)
+			for _, i := range rng.Perm(len(fixtureInterests))[:rng.Intn(5)] {
+				accin.Interests = append(accin.Interests, fixtureInterests[i])
+			}
+			for i := rng.Intn(4); i > 0; i-- {
+				accin.Likes = append(accin.Likes, Like{Id: 1 + rng.Int31n(fixtureSize), Ts: 1500000000 + rng.Int31n(1000)})
+			}
+			InsertAccount(&accin)
+		}
+		Compact()
+	})
+}
+
+// serve passes request through the handler and returns status and body.
+func serve(t *testing.T, method, uri, body string) (int, string) {
+	raw := method + " " + uri + " HTTP/1.1\r\n"
+	if body != "" {
+		raw += "Content-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	}
+	resp, b := roundTrip(t, raw+"\r\n"+body, func(r *Request) { HTTPServeRequest(r) })
+	return resp.StatusCode, string(b)
+}
+
+type filterAccount struct {
+	Id    int32  `json:"id"`
+	Email string `json:"email"`
+}
+
+// filterIds returns ids of /accounts/filter/ response.
+func filterIds(t *testing.T, args string) []int32 {
+	code, body := serve(t, "GET", "/accounts/filter/?"+args, "")
+	require.Equal(t, 200, code, "%s: %s", args, body)
+	var res struct {
+		Accounts []filterAccount `json:"accounts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	ids := make([]int32, 0, len(res.Accounts))
+	for _, acc := range res.Accounts {
+		ids = append(ids, acc.Id)
+	}
+	return ids
+}
+
+// bruteIds returns up to limit ids of accounts matching f, descending.
+func bruteIds(limit int, f func(acc *Account) bool) []int32 {
+	ids := []int32{}
+	for uid := MaxId - 1; uid > 0 && len(ids) < limit; uid-- {
+		if acc := HasAccount(uid); acc != nil && f(acc) {
+			ids = append(ids, uid)
+		}
+	}
+	return ids
+}
@@ -1,22 +1,30 @@
 package main
 
 import (
+	"math"
 	"math/bits"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	jsoniter "github.com/json-iterator/go"
 
-	"github.com/funny-falcon/highloadcup2018/bitmap3"
 	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
 )
 
 func getHandler(ctx *Request, path string) {
+	dictMutex.RLock()
+	defer dictMutex.RUnlock()
 	switch {
 	case path == "filter/":
-		doFilter(ctx)
+		cachedGet(ctx, path, doFilter)
 	case path == "group/":
-		doGroup(ctx)
+		cachedGet(ctx, path, doGroup)
+	case path == "top/":
+		doTop(ctx)
+	case path == "similar/":
+		doSimilar(ctx)
 	case strings.HasSuffix(path, "/suggest/"):
 		ids := path[:strings.IndexByte(path, '/')]
 		id, err := strconv.Atoi(ids)
@@ -33,6 +41,22 @@ func getHandler(ctx *Request, path string) {
 			return
 		}
 		doRecommend(ctx, id)
+	case strings.HasSuffix(path, "/matches/"):
+		ids := path[:strings.IndexByte(path, '/')]
+		id, err := strconv.Atoi(ids)
+		if err != nil {
+			ctx.SetStatusCode(400)
+			return
+		}
+		doMatches(ctx, id)
+	case strings.HasSuffix(path, "/likes/"), strings.HasSuffix(path, "/likers/"):
+		ids := path[:strings.IndexByte(path, '/')]
+		id, err := strconv.Atoi(ids)
+		if err != nil {
+			ctx.SetStatusCode(400)
+			return
+		}
+		doLikesList(ctx, id, strings.HasSuffix(path, "/likers/"))
 	default:
 		ctx.SetStatusCode(404)
 	}
@@ -57,416 +81,522 @@ type OutFields struct {
 var EmptyFilterRes = []byte(`{"accounts":[]}`)
 var EmptyGroupRes = []byte(`{"groups":[]}`)
 
-func doFilter(ctx *Request) {
-	maps := make([]bitmap.IBitmap, 0, 4)
-	filters := []func(int32, *Account) bool{}
+// filterQuery accumulates bitmaps and account filters for /filter/
+// predicates, so other endpoints could accept the same predicates.
+type filterQuery struct {
+	maps      []bitmap.IBitmap
+	filters   []func(int32, *Account) bool
+	outFields OutFields
+	correct   bool
+	emptyRes  bool
+	pooled    []*bitmap.Bitmap
+
+	// interests_any maps, their position in maps plus one and
+	// interests_min_match threshold.
+	anyMaps  []bitmap.IBitmap
+	anyAt    int
+	minMatch int
+	anySeen  bool
+}
 
-	correct := true
-	emptyRes := false
-	limit := -1
-	var outFields OutFields
+func newFilterQuery() *filterQuery {
+	return &filterQuery{
+		maps:    make([]bitmap.IBitmap, 0, 4),
+		correct: true,
+	}
+}
 
-	for _, kv := range ctx.Args {
-		key, val := kv.k, kv.v
-		func() {
-			if !correct {
-				return
+// rangeRawMax is a size of range result kept as uids list. Larger results
+// are collected into pooled bitmap.
+const rangeRawMax = 4096
+
+var rangeMapPool = sync.Pool{
+	New: func() interface{} { return &bitmap.Bitmap{} },
+}
+
+// pooledMap returns empty bitmap released together with query.
+func (q *filterQuery) pooledMap() *bitmap.Bitmap {
+	mp := rangeMapPool.Get().(*bitmap.Bitmap)
+	q.pooled = append(q.pooled, mp)
+	return mp
+}
+
+// release returns pooled bitmaps. Query must not be used after.
+func (q *filterQuery) release() {
+	for _, mp := range q.pooled {
+		mp.Reset()
+		rangeMapPool.Put(mp)
+	}
+	q.pooled = nil
+}
+
+// addEmailRange adds accounts whose email is >= from, passes skip (if
+// any) and is before first email failing while.
+func (q *filterQuery) addEmailRange(from string, skip, while func(string) bool) {
+	var uids bitmap.RawUids
+	var mp *bitmap.Bitmap
+	EmailSorted.Ascend(from, func(id uint32, s string) bool {
+		if while != nil && !while(s) {
+			return false
+		}
+		if skip != nil && !skip(s) {
+			return true
+		}
+		uid := int32(EmailIndex.GetHndl(id).Handle)
+		if mp != nil {
+			mp.Set(uid)
+			return true
+		}
+		uids = append(uids, uid)
+		if len(uids) > rangeRawMax {
+			mp = q.pooledMap()
+			for _, uid := range uids {
+				mp.Set(uid)
 			}
-			logf("arg %s: %s", key, val)
-			if key == "limit" {
-				var err error
-				limit, err = strconv.Atoi(string(val))
-				if err != nil || limit == 0 {
-					logf("limit: %s", err)
-					correct = false
-				}
-				return
+		}
+		return true
+	})
+	switch {
+	case mp != nil:
+		q.maps = append(q.maps, mp)
+	case len(uids) == 0:
+		q.emptyRes = true
+	default:
+		sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+		q.maps = append(q.maps, uids)
+	}
+}
+
+// placeAny puts interests_any bitmap into maps respecting
+// interests_min_match. Whichever of them comes last replaces bitmap placed
+// by the first one.
+func (q *filterQuery) placeAny() {
+	var mp bitmap.IBitmap
+	switch {
+	case q.anyMaps == nil:
+		// no interests_any yet: empty placeholder
+		mp = q.pooledMap()
+	case q.minMatch > len(q.anyMaps):
+		q.emptyRes = true
+		return
+	default:
+		mp = bitmap.NewThresholdBitmap(q.anyMaps, q.minMatch)
+	}
+	if q.anyAt == 0 {
+		q.maps = append(q.maps, mp)
+		q.anyAt = len(q.maps)
+	} else {
+		q.maps[q.anyAt-1] = mp
+	}
+}
+
+// finish checks predicates depending on each other after all are added.
+func (q *filterQuery) finish() {
+	if q.minMatch > 0 && !q.anySeen {
+		logf("interests_min_match without interests_any")
+		q.correct = false
+	}
+}
+
+// addArg applies predicate. It returns false for unknown key.
+func (q *filterQuery) addArg(skey, sval string) bool {
+	switch skey {
+	case "sex_eq":
+		q.outFields.Sex = true
+		switch sval {
+		case "m":
+			q.maps = append(q.maps, &MaleMap)
+			//q.filters = append(q.filters, func(uid int32, _ *Account) bool { return uid&1 == 1 })
+		case "f":
+			q.maps = append(q.maps, &FemaleMap)
+			//q.filters = append(q.filters, func(uid int32, _ *Account) bool { return uid&1 == 0 })
+		default:
+			logf("sex_eq incorrect")
+			q.correct = false
+		}
+	case "email_domain":
+		domain := sval
+		ix := DomainsStrings.Find(domain)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		iterator := DomainsStrings.GetMap(ix)
+		q.maps = append(q.maps, iterator)
+	case "email_gt":
+		if len(sval) == 0 {
+			return true // all are greater
+		}
+		q.addEmailRange(sval, func(s string) bool { return s != sval }, nil)
+	case "email_lt":
+		if len(sval) == 0 {
+			q.emptyRes = true
+			return true // none are less
+		}
+		q.addEmailRange("", nil, func(s string) bool { return s < sval })
+	case "email_between":
+		ix := strings.IndexByte(sval, ',')
+		if ix < 0 {
+			logf("email_between incorrect")
+			q.correct = false
+			return true
+		}
+		from, to := sval[:ix], sval[ix+1:]
+		q.addEmailRange(from, nil, func(s string) bool { return s <= to })
+	case "email_starts":
+		if len(sval) == 0 {
+			return true
+		}
+		q.addEmailRange(sval, nil, func(s string) bool { return strings.HasPrefix(s, sval) })
+	case "status_eq":
+		q.outFields.Status = true
+		switch sval {
+		case StatusFree:
+			q.maps = append(q.maps, &FreeMap)
+		case StatusMeeting:
+			q.maps = append(q.maps, &MeetingMap)
+		case StatusComplex:
+			q.maps = append(q.maps, &ComplexMap)
+		default:
+			logf("status_eq incorrect")
+			q.correct = false
+			return true
+		}
+	case "status_neq":
+		q.outFields.Status = true
+		switch sval {
+		case StatusFree:
+			q.maps = append(q.maps, &MeetingOrComplexMap)
+		case StatusMeeting:
+			q.maps = append(q.maps, &FreeOrComplexMap)
+		case StatusComplex:
+			q.maps = append(q.maps, &FreeOrMeetingMap)
+		default:
+			logf("status_neq incorrect")
+			q.correct = false
+			return true
+		}
+	case "fname_eq":
+		q.outFields.Fname = true
+		ix := FnameStrings.Find(sval)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, FnameStrings.GetMap(ix))
+	case "fname_any":
+		q.outFields.Fname = true
+		names := strings.Split(sval, ",")
+		orIters := make([]bitmap.IBitmap, 0, len(names))
+		for _, name := range names {
+			ix := FnameStrings.Find(name)
+			if ix == 0 {
+				continue
 			}
-			skey := string(key)
-			sval := string(val)
-			switch skey {
-			case "sex_eq":
-				outFields.Sex = true
-				switch sval {
-				case "m":
-					maps = append(maps, &MaleMap)
-					//filters = append(filters, func(uid int32, _ *Account) bool { return uid&1 == 1 })
-				case "f":
-					maps = append(maps, &FemaleMap)
-					//filters = append(filters, func(uid int32, _ *Account) bool { return uid&1 == 0 })
-				default:
-					logf("sex_eq incorrect")
-					correct = false
-				}
-			case "email_domain":
-				domain := sval
-				ix := DomainsStrings.Find(domain)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				iterator := DomainsStrings.GetMap(ix)
-				maps = append(maps, iterator)
-			case "email_gt":
-				if len(val) == 0 {
-					return // all are greater
-				}
-				email := sval
-				emailgt := GetEmailPrefix(email)
-				filters = append(filters, func(_ int32, acc *Account) bool {
-					return acc.EmailStart >= emailgt
-				})
-				if len(email) > 4 {
-					filters = append(filters, func(_ int32, acc *Account) bool {
-						accEmail := EmailIndex.GetStr(acc.Email)
-						return accEmail > email
-					})
-				}
-				chix := int(email[0]) - 'a'
-				if chix < 0 {
-					return
-				} else if chix > 25 {
-					chix = 25
-				}
-				maps = append(maps, &EmailGtIndexes[chix])
-			case "email_lt":
-				if len(val) == 0 {
-					emptyRes = true
-					return // all are greater
-				}
-				email := sval
-				emaillt := GetEmailPrefix(email)
-				logf("emaillt %08x", emaillt)
-				filters = append(filters, func(_ int32, acc *Account) bool {
-					//logf("EmailStart %08x", acc.EmailStart)
-					return acc.EmailStart < emaillt
-				})
-				if len(email) > 4 {
-					filters = append(filters, func(_ int32, acc *Account) bool {
-						accEmail := EmailIndex.GetStr(acc.Email)
-						return accEmail < email
-					})
-				}
-				chix := int(email[0]) - 'a'
-				if chix < 0 {
-					chix = 0
-				} else if chix > 25 {
-					return
-				}
-				maps = append(maps, &EmailLtIndexes[chix])
-			case "status_eq":
-				outFields.Status = true
-				switch sval {
-				case StatusFree:
-					maps = append(maps, &FreeMap)
-				case StatusMeeting:
-					maps = append(maps, &MeetingMap)
-				case StatusComplex:
-					maps = append(maps, &ComplexMap)
-				default:
-					logf("status_eq incorrect")
-					correct = false
-					return
-				}
-			case "status_neq":
-				outFields.Status = true
-				switch sval {
-				case StatusFree:
-					maps = append(maps, &MeetingOrComplexMap)
-				case StatusMeeting:
-					maps = append(maps, &FreeOrComplexMap)
-				case StatusComplex:
-					maps = append(maps, &FreeOrMeetingMap)
-				default:
-					logf("status_neq incorrect")
-					correct = false
-					return
-				}
-			case "fname_eq":
-				outFields.Fname = true
-				ix := FnameStrings.Find(sval)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, FnameStrings.GetMap(ix))
-			case "fname_any":
-				outFields.Fname = true
-				names := strings.Split(sval, ",")
-				orIters := make([]bitmap.IBitmap, 0, len(names))
-				for _, name := range names {
-					ix := FnameStrings.Find(name)
-					if ix == 0 {
-						continue
-					}
-					orIters = append(orIters, FnameStrings.GetMap(ix))
-				}
-				if len(orIters) == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, bitmap.NewOrBitmap(orIters))
-			case "fname_null":
-				outFields.Fname = true
-				switch sval {
-				case "1":
-					maps = append(maps, &FnameStrings.Null)
-				case "0":
-					maps = append(maps, &FnameStrings.NotNull)
-					/*
-						filters = append(filters, func(acc *Account) bool {
-							return acc.Fname != 0
-						})
-					*/
-				default:
-					logf("fname_null incorrect")
-					correct = false
-				}
-			case "sname_eq":
-				outFields.Sname = true
-				ix := SnameStrings.Find(sval)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, SnameStrings.GetMap(ix))
-			case "sname_starts":
-				outFields.Sname = true
-				SnameOnce.Sure()
-				pref := sval
-				i, j := SnameSorted.PrefixRange(pref)
-				if i == j {
-					emptyRes = true
-					return
-				}
-				orIters := make([]bitmap.IBitmap, j-i)
-				for k := i; k < j; k++ {
-					orIters[k-i] = SnameStrings.GetMap(SnameSorted.Ix[k])
-				}
-				maps = append(maps, bitmap.NewOrBitmap(orIters))
-			case "sname_null":
-				outFields.Sname = true
-				switch sval {
-				case "1":
-					maps = append(maps, &SnameStrings.Null)
-				case "0":
-					maps = append(maps, &SnameStrings.NotNull)
-					/*
-						filters = append(filters, func(acc *Account) bool {
-							return acc.Sname != 0
-						})
-					*/
-				default:
-					logf("sname_null incorrect")
-					correct = false
-				}
-			case "phone_code":
-				outFields.Phone = true
-				code := sval
-				ix := PhoneCodesStrings.Find(code)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, PhoneCodesStrings.GetMap(ix))
-			case "phone_null":
-				outFields.Phone = true
-				switch sval {
-				case "1":
-					maps = append(maps, &PhoneIndex.Null)
-				case "0":
-					maps = append(maps, &PhoneIndex.NotNull)
-				default:
-					logf("phone_null incorrect")
-					correct = false
-				}
-			case "country_eq":
-				outFields.Country = true
-				ix := CountryStrings.Find(sval)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, CountryStrings.GetMap(ix))
-			case "country_null":
-				outFields.Country = true
-				switch sval {
-				case "1":
-					maps = append(maps, &CountryStrings.Null)
-				case "0":
-					maps = append(maps, &CountryStrings.NotNull)
-				default:
-					logf("country_null incorrect")
-					correct = false
-				}
-			case "city_eq":
-				outFields.City = true
-				ix := CityStrings.Find(sval)
-				if ix == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, CityStrings.GetMap(ix))
-			case "city_any":
-				outFields.City = true
-				cities := strings.Split(sval, ",")
-				orIters := make([]bitmap.IBitmap, 0, len(cities))
-				for _, name := range cities {
-					ix := CityStrings.Find(name)
-					if ix == 0 {
-						continue
-					}
-					orIters = append(orIters, CityStrings.GetMap(ix))
-				}
-				if len(orIters) == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, bitmap.NewOrBitmap(orIters))
-			case "city_null":
-				outFields.City = true
-				switch sval {
-				case "1":
-					maps = append(maps, &CityStrings.Null)
-				case "0":
-					maps = append(maps, &CityStrings.NotNull)
-				default:
-					logf("city_null incorrect")
-					correct = false
-				}
-			case "birth_gt":
-				outFields.Birth = true
-				n, err := strconv.Atoi(sval)
-				if err != nil {
-					logf("birth_gt incorrect")
-					correct = false
-					return
-				}
-				birth := int32(n)
-				filters = append(filters, func(_ int32, acc *Account) bool {
-					return acc.Birth > birth
+			orIters = append(orIters, FnameStrings.GetMap(ix))
+		}
+		if len(orIters) == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, bitmap.NewOrBitmap(orIters))
+	case "fname_null":
+		q.outFields.Fname = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &FnameStrings.Null)
+		case "0":
+			q.maps = append(q.maps, &FnameStrings.NotNull)
+			/*
+				q.filters = append(q.filters, func(acc *Account) bool {
+					return acc.Fname != 0
 				})
-				birthYear := GetBirthYear(birth)
-				if birthYear < 1995-1950 {
-					return
-				}
-				orIters := make([]bitmap.IBitmap, 0, len(BirthYearIndexes)-int(birthYear)+1)
-				for ; int(birthYear) < len(BirthYearIndexes); birthYear++ {
-					orIters = append(orIters, &BirthYearIndexes[birthYear])
-				}
-				maps = append(maps, bitmap.NewOrBitmap(orIters))
-			case "birth_lt":
-				outFields.Birth = true
-				n, err := strconv.Atoi(sval)
-				if err != nil {
-					logf("birth_lt incorrect")
-					correct = false
-					return
-				}
-				birth := int32(n)
-				filters = append(filters, func(_ int32, acc *Account) bool {
-					return acc.Birth < birth
+			*/
+		default:
+			logf("fname_null incorrect")
+			q.correct = false
+		}
+	case "sname_eq":
+		q.outFields.Sname = true
+		ix := SnameStrings.Find(sval)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, SnameStrings.GetMap(ix))
+	case "sname_starts":
+		q.outFields.Sname = true
+		ids := SnameSorted.PrefixRange(sval)
+		if len(ids) == 0 {
+			q.emptyRes = true
+			return true
+		}
+		orIters := make([]bitmap.IBitmap, len(ids))
+		for k, id := range ids {
+			orIters[k] = SnameStrings.GetMap(id)
+		}
+		q.maps = append(q.maps, bitmap.NewOrBitmap(orIters))
+	case "sname_null":
+		q.outFields.Sname = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &SnameStrings.Null)
+		case "0":
+			q.maps = append(q.maps, &SnameStrings.NotNull)
+			/*
+				q.filters = append(q.filters, func(acc *Account) bool {
+					return acc.Sname != 0
 				})
-				birthYear := GetBirthYear(birth)
-				if birthYear > 1988-1950 {
-					return
-				}
-				orIters := make([]bitmap.IBitmap, 0, birthYear+1)
-				for ; birthYear >= 0; birthYear-- {
-					orIters = append(orIters, &BirthYearIndexes[birthYear])
-				}
-				maps = append(maps, bitmap.NewOrBitmap(orIters))
-			case "birth_year":
-				outFields.Birth = true
-				year, err := strconv.Atoi(sval)
-				if err != nil {
-					logf("birth_year incorrect")
-					correct = false
-					return
-				}
-				if year < 1950 || year-1950 >= len(BirthYearIndexes) {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, &BirthYearIndexes[year-1950])
-			case "interests_contains", "interests_any":
-				interests := strings.Split(sval, ",")
-				iters := make([]bitmap.IBitmap, 0, len(interests))
-				for _, interest := range interests {
-					ix := InterestStrings.Find(interest)
-					if ix == 0 {
-						if skey == "interests_contains" {
-							emptyRes = true
-							return
-						}
-						continue
-					}
-					iters = append(iters, InterestStrings.GetMap(ix))
-				}
-				if len(iters) == 0 {
-					if skey == "interests_any" {
-						emptyRes = true
-					}
-					return
-				}
-				if skey == "interests_any" {
-					maps = append(maps, bitmap.NewOrBitmap(iters))
-				} else {
-					maps = append(maps, iters...)
-				}
-			case "likes_contains":
-				likesStrs := strings.Split(val, ",")
-				likesMaps := make([]*bitmap.Likes, 0, len(likesStrs))
-				for _, likeS := range likesStrs {
-					n, err := strconv.Atoi(string(likeS))
-					if err != nil || n <= 0 || n >= int(MaxId) {
-						logf("likes_contains incorrect")
-						correct = false
-						return
-					}
-					w := GetLikers(int32(n))
-					if w == nil {
-						emptyRes = true
-						return
-					}
-					likesMaps = append(likesMaps, w)
-				}
-				likers := bitmap.AndLikes(likesMaps)
-				if len(likers) == 0 {
-					emptyRes = true
-					return
-				}
-				maps = append(maps, likers)
-			case "premium_now":
-				outFields.Premium = true
-				maps = append(maps, &PremiumNow)
-			case "premium_null":
-				outFields.Premium = true
-				switch sval {
-				case "1":
-					maps = append(maps, &PremiumNull)
-				case "0":
-					maps = append(maps, &PremiumNotNull)
-				default:
-					logf("premium_null incorrect")
-					correct = false
+			*/
+		default:
+			logf("sname_null incorrect")
+			q.correct = false
+		}
+	case "phone_code":
+		q.outFields.Phone = true
+		code := sval
+		ix := PhoneCodesStrings.Find(code)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, PhoneCodesStrings.GetMap(ix))
+	case "phone_null":
+		q.outFields.Phone = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &PhoneIndex.Null)
+		case "0":
+			q.maps = append(q.maps, &PhoneIndex.NotNull)
+		default:
+			logf("phone_null incorrect")
+			q.correct = false
+		}
+	case "country_eq":
+		q.outFields.Country = true
+		ix := CountryStrings.Find(sval)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, CountryStrings.GetMap(ix))
+	case "country_null":
+		q.outFields.Country = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &CountryStrings.Null)
+		case "0":
+			q.maps = append(q.maps, &CountryStrings.NotNull)
+		default:
+			logf("country_null incorrect")
+			q.correct = false
+		}
+	case "city_eq":
+		q.outFields.City = true
+		ix := CityStrings.Find(sval)
+		if ix == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, CityStrings.GetMap(ix))
+	case "city_any":
+		q.outFields.City = true
+		cities := strings.Split(sval, ",")
+		orIters := make([]bitmap.IBitmap, 0, len(cities))
+		for _, name := range cities {
+			ix := CityStrings.Find(name)
+			if ix == 0 {
+				continue
+			}
+			orIters = append(orIters, CityStrings.GetMap(ix))
+		}
+		if len(orIters) == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, bitmap.NewOrBitmap(orIters))
+	case "city_null":
+		q.outFields.City = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &CityStrings.Null)
+		case "0":
+			q.maps = append(q.maps, &CityStrings.NotNull)
+		default:
+			logf("city_null incorrect")
+			q.correct = false
+		}
+	case "birth_year":
+		q.outFields.Birth = true
+		year, err := strconv.Atoi(sval)
+		if err != nil {
+			logf("birth_year incorrect")
+			q.correct = false
+			return true
+		}
+		if year < 1950 || year-1950 >= len(BirthYearIndexes) {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, &BirthYearIndexes[year-1950])
+	case "interests_contains", "interests_any":
+		if skey == "interests_any" {
+			q.anySeen = true
+		}
+		interests := strings.Split(sval, ",")
+		iters := make([]bitmap.IBitmap, 0, len(interests))
+		for _, interest := range interests {
+			ix := InterestStrings.Find(interest)
+			if ix == 0 {
+				if skey == "interests_contains" {
+					q.emptyRes = true
+					return true
 				}
-			case "query_id":
-				// ignore
-			default:
+				continue
+			}
+			iters = append(iters, InterestStrings.GetMap(ix))
+		}
+		if len(iters) == 0 {
+			if skey == "interests_any" {
+				q.emptyRes = true
+			}
+			return true
+		}
+		if skey == "interests_any" {
+			q.anyMaps = iters
+			q.placeAny()
+		} else {
+			q.maps = append(q.maps, iters...)
+		}
+	case "interests_none":
+		var mask InterestMask
+		for _, interest := range strings.Split(sval, ",") {
+			if ix := InterestStrings.Find(interest); ix != 0 {
+				mask.Set(uint8(ix))
+			}
+		}
+		if mask.IntersectCount(mask) == 0 {
+			return true
+		}
+		q.filters = append(q.filters, func(uid int32, _ *Account) bool {
+			return GetInterest(uid).IntersectCount(mask) == 0
+		})
+	case "interests_min_match":
+		n, err := strconv.Atoi(sval)
+		if err != nil || n <= 0 {
+			logf("interests_min_match incorrect")
+			q.correct = false
+			return true
+		}
+		q.minMatch = n
+		q.placeAny()
+	case "likes_contains":
+		likesStrs := strings.Split(sval, ",")
+		likesMaps := make([]*bitmap.Likes, 0, len(likesStrs))
+		for _, likeS := range likesStrs {
+			n, err := strconv.Atoi(string(likeS))
+			if err != nil || n <= 0 || n >= int(MaxId) {
+				logf("likes_contains incorrect")
+				q.correct = false
+				return true
+			}
+			w := GetLikers(int32(n))
+			if w == nil {
+				q.emptyRes = true
+				return true
+			}
+			likesMaps = append(likesMaps, w)
+		}
+		likers := bitmap.AndLikes(likesMaps)
+		if len(likers) == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, likers)
+	case "premium_now":
+		q.outFields.Premium = true
+		q.maps = append(q.maps, &PremiumNow)
+	case "premium_null":
+		q.outFields.Premium = true
+		switch sval {
+		case "1":
+			q.maps = append(q.maps, &PremiumNull)
+		case "0":
+			q.maps = append(q.maps, &PremiumNotNull)
+		default:
+			logf("premium_null incorrect")
+			q.correct = false
+		}
+	case "email_contains", "email_like":
+		if len(sval) == 0 {
+			q.correct = false
+			return true
+		}
+		uids := EmailIndex.SearchUids(&EmailNgrams, sval, skey == "email_like")
+		if len(uids) == 0 {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, uids)
+	case "fname_contains", "fname_like", "sname_contains", "sname_like":
+		if len(sval) == 0 {
+			q.correct = false
+			return true
+		}
+		ss, ni := &FnameStrings, &FnameNgrams
+		if skey[0] == 's' {
+			ss, ni = &SnameStrings, &SnameNgrams
+			q.outFields.Sname = true
+		} else {
+			q.outFields.Fname = true
+		}
+		mp := ss.SearchMap(ni, sval, strings.HasSuffix(skey, "_like"))
+		if mp == nil {
+			q.emptyRes = true
+			return true
+		}
+		q.maps = append(q.maps, mp)
+	default:
+		return q.addRangeArg(skey, sval)
+	}
+	return true
+}
+
+func doFilter(ctx *Request) {
+	q := newFilterQuery()
+	defer q.release()
+	limit := -1
+
+	for _, kv := range ctx.Args {
+		key, val := kv.k, kv.v
+		logf("arg %s: %s", key, val)
+		switch key {
+		case "limit":
+			var err error
+			limit, err = strconv.Atoi(string(val))
+			if err != nil || limit == 0 {
+				logf("limit: %s", err)
+				q.correct = false
+			}
+		case "query_id":
+			// ignore
+		default:
+			if !q.addArg(key, val) {
 				logf("default incorrect")
-				correct = false
+				q.correct = false
 			}
-		}()
-		if !correct {
+		}
+		if !q.correct {
 			break
 		}
 	}
-	if !correct || limit < 0 {
-		logf("correct ", correct, " limit ", limit)
+	q.finish()
+	maps, filters, outFields := q.maps, q.filters, q.outFields
+	if !q.correct || limit < 0 {
+		logf("correct ", q.correct, " limit ", limit)
 		ctx.SetStatusCode(400)
 		return
-	} else if emptyRes {
+	} else if q.emptyRes {
 		logf("empty result")
 		ctx.SetStatusCode(200)
 		ctx.SetBody(EmptyFilterRes)
@@ -535,6 +665,7 @@ const (
 	GroupByCity      = 4
 	GroupByCountry   = 8
 	GroupByInterests = 16
+	GroupByAge       = 32
 
 	GroupByCitySex       = GroupByCity | GroupBySex
 	GroupByCityStatus    = GroupByCity | GroupByStatus
@@ -553,6 +684,8 @@ type GroupBy struct {
 func doGroup(ctx *Request) {
 	logf("doGroup")
 	iterators := make([]bitmap.IBitmap, 0, 4)
+	q := newFilterQuery()
+	defer q.release()
 	groupBy := uint32(0)
 
 	correct := true
@@ -566,6 +699,7 @@ func doGroup(ctx *Request) {
 	birthId := 0
 	joinId := 0
 	otherFilters := false
+	ageRanges := AgeRanges
 
 	for _, kv := range ctx.Args {
 		key, val := kv.k, kv.v
@@ -606,6 +740,8 @@ func doGroup(ctx *Request) {
 						groupBy |= GroupByCountry
 					case "interests":
 						groupBy |= GroupByInterests
+					case "age":
+						groupBy |= GroupByAge
 					default:
 						correct = false
 						return
@@ -617,6 +753,9 @@ func doGroup(ctx *Request) {
 					if groupBy&GroupByInterests != 0 {
 						logf("group interests with other: %s", sval)
 						correct = false
+					} else if groupBy&GroupByAge != 0 {
+						logf("group age with other: %s", sval)
+						correct = false
 					} else if groupBy&^(GroupByCity|GroupByCountry) == 0 {
 						logf("group city with country: %s", sval)
 						correct = false
@@ -727,18 +866,33 @@ func doGroup(ctx *Request) {
 					return
 				}
 				otherFilters = true
-				iterators = append(iterators, bitmap.AndLikes([]*bitmap3.Likes{w}))
+				iterators = append(iterators, bitmap.AndLikes([]*bitmap.Likes{w}))
+			case "age_ranges":
+				var ok bool
+				if ageRanges, ok = ParseAgeRanges(sval); !ok {
+					logf("age_ranges incorrect")
+					correct = false
+				}
 			case "query_id":
 				// ignore
 			default:
-				logf("default incorrect")
-				correct = false
+				if !q.addRangeArg(skey, sval) {
+					logf("default incorrect")
+					correct = false
+					return
+				}
+				correct = q.correct
+				emptyRes = emptyRes || q.emptyRes
 			}
 		}()
 		if !correct {
 			break
 		}
 	}
+	if len(q.maps) != 0 {
+		otherFilters = true
+		iterators = append(iterators, q.maps...)
+	}
 	logf("groupBy %d iterators %#v limit %d order %d", groupBy, iterators, limit, order)
 
 	if !correct || limit < 0 || order == 0 {
@@ -819,6 +973,35 @@ func doGroup(ctx *Request) {
 				stream.Write([]byte("},"))
 			}
 		}
+	case groupBy == GroupByAge:
+		groups = make([]groupCounter, len(ageRanges)+1)
+		for i := range groups {
+			groups[i].u = uint32(i)
+			_, from, to := AgeGroup(ageRanges, i)
+			lo, hi := AgeBirthRange(from, to)
+			mp := BirthRange.Range(lo, hi, q.pooledMap)
+			if mp == nil {
+				continue
+			}
+			maps := append(iterators[:len(iterators):len(iterators)], mp)
+			groups[i].s = bitmap.Count(bitmap.NewAndBitmap(maps))
+		}
+
+		groups = SortGroupLimit(limit, order, groups, func(idi, idj uint32) bool {
+			return idi < idj
+		})
+		for i, gr := range groups {
+			label, _, _ := AgeGroup(ageRanges, int(gr.u))
+			stream.Write([]byte(`{"age":`))
+			stream.WriteString(label)
+			stream.Write([]byte(`,"count":`))
+			stream.WriteInt32(int32(gr.s))
+			if i == len(groups)-1 {
+				stream.WriteObjectEnd()
+			} else {
+				stream.Write([]byte("},"))
+			}
+		}
 	default:
 		cityMult := 1
 		if groupBy&GroupBySex != 0 {
@@ -1078,9 +1261,21 @@ func doSuggest(ctx *Request, iid int) {
 
 	//iterators := make([]bitmap.IBitmap, 0, 4)
 	var filter func(uid int32) bool
+	addFilter := func(f func(uid int32) bool) {
+		if filter != nil {
+			old := filter
+			filter = func(uid int32) bool { return old(uid) && f(uid) }
+		} else {
+			filter = f
+		}
+	}
 	correct := true
 	emptyRes := false
 	limit := -1
+	withScore := false
+	metric := SuggestDefault
+	halfLife := float64(SuggestHalfLife)
+	similar := false
 
 	ctx.VisitArgs(func(key string, val string) {
 		if !correct {
@@ -1109,12 +1304,7 @@ func doSuggest(ctx *Request, iid int) {
 				emptyRes = true
 				return
 			}
-			if filter != nil {
-				old := filter
-				filter = func(uid int32) bool { return old(uid) && uint32(RefAccount(uid).Country) == ix }
-			} else {
-				filter = func(uid int32) bool { return uint32(RefAccount(uid).Country) == ix }
-			}
+			addFilter(func(uid int32) bool { return uint32(RefAccount(uid).Country) == ix })
 			//iterators = append(iterators, CountryStrings.GetMap(ix))
 		case "city":
 			if len(sval) == 0 {
@@ -1127,13 +1317,90 @@ func doSuggest(ctx *Request, iid int) {
 				emptyRes = true
 				return
 			}
-			if filter != nil {
-				old := filter
-				filter = func(uid int32) bool { return old(uid) && uint32(RefAccount(uid).City) == ix }
+			addFilter(func(uid int32) bool { return uint32(RefAccount(uid).City) == ix })
+			//iterators = append(iterators, CityStrings.GetMap(ix))
+		case "sex_eq":
+			var sex bool
+			switch sval {
+			case "m":
+				sex = true
+			case "f":
+			default:
+				logf("sex_eq incorrect")
+				correct = false
+				return
+			}
+			addFilter(func(uid int32) bool { return RefAccount(uid).Sex == sex })
+		case "birth_gt", "birth_lt":
+			n, err := strconv.Atoi(sval)
+			if err != nil {
+				logf("%s incorrect", skey)
+				correct = false
+				return
+			}
+			birth := int32(n)
+			if skey == "birth_gt" {
+				addFilter(func(uid int32) bool { return RefAccount(uid).Birth > birth })
 			} else {
-				filter = func(uid int32) bool { return uint32(RefAccount(uid).City) == ix }
+				addFilter(func(uid int32) bool { return RefAccount(uid).Birth < birth })
+			}
+		case "status_eq":
+			status, ok := GetStatusIx(sval)
+			if !ok {
+				logf("status_eq incorrect")
+				correct = false
+				return
+			}
+			addFilter(func(uid int32) bool { return RefAccount(uid).Status == status })
+		case "interests_contains":
+			if len(sval) == 0 {
+				correct = false
+				return
+			}
+			var mask InterestMask
+			for _, interest := range strings.Split(sval, ",") {
+				ix := InterestStrings.Find(interest)
+				if ix == 0 {
+					emptyRes = true
+					return
+				}
+				mask.Set(uint8(ix))
+			}
+			addFilter(func(uid int32) bool { return GetInterest(uid).Contains(mask) })
+		case "metric":
+			switch sval {
+			case SuggestDefault, SuggestJaccard, SuggestCosine, SuggestDecay:
+				metric = sval
+			default:
+				logf("metric incorrect")
+				correct = false
+			}
+		case "halflife":
+			n, err := strconv.Atoi(sval)
+			if err != nil || n <= 0 {
+				logf("halflife incorrect")
+				correct = false
+				return
+			}
+			halfLife = float64(n)
+		case "similar":
+			switch sval {
+			case "1":
+				similar = true
+			case "0":
+			default:
+				logf("similar incorrect")
+				correct = false
+			}
+		case "with_score":
+			switch sval {
+			case "1":
+				withScore = true
+			case "0":
+			default:
+				logf("with_score incorrect")
+				correct = false
 			}
-			//iterators = append(iterators, CityStrings.GetMap(ix))
 		case "query_id":
 			// ignore
 		default:
@@ -1184,24 +1451,45 @@ func doSuggest(ctx *Request, iid int) {
 		if ts == 0 {
 			panic("no")
 		}
-		for _, ucnt := range likers.Data[:likers.Size] {
-			oid := ucnt.Uid
+		likers.Stats(func(st bitmap.LikeStat) bool {
+			oid := st.Uid
 			if filter != nil && !filter(oid) {
-				continue
+				return true
 			}
 			//logf("oid %d", oid)
-			ots := ucnt.Ts
-			if ots < 0 {
-				ots = -ots
-			}
-			dlt := ots - ts
+			dlt := st.Avg - ts
 			if dlt < 0 {
 				dlt = -dlt
 			} else if dlt == 0 {
 				dlt = 1
 			}
 			cnt := hsh.Insert(uint32(oid))
-			cnt.s += 1.0 / float64(dlt)
+			switch metric {
+			case SuggestDefault:
+				cnt.s += 1.0 / float64(dlt)
+			case SuggestDecay:
+				cnt.s += math.Exp2(-float64(dlt) / halfLife)
+			default:
+				cnt.s++
+			}
+			return true
+		})
+	}
+
+	switch metric {
+	case SuggestJaccard, SuggestCosine:
+		mine := float64(small.Size)
+		for i := range hsh {
+			cnt := &hsh[i]
+			if cnt.u == 0 {
+				continue
+			}
+			theirs := float64(bitmap.GetSmall(&RefAccount(int32(cnt.u)).Likes).Size)
+			if metric == SuggestJaccard {
+				cnt.s /= mine + theirs - cnt.s
+			} else {
+				cnt.s /= math.Sqrt(mine * theirs)
+			}
 		}
 	}
 
@@ -1213,12 +1501,21 @@ func doSuggest(ctx *Request, iid int) {
 	groups := Heapify(hsh)
 	//logf("groups %v", groups)
 
+	if similar {
+		outSimilar(ctx, groups, id, limit)
+		return
+	}
+
 	uidHash := newUidHash(limit + int(small.Size))
 	for _, oid := range small.Data[:small.Size] {
 		uidHash.Insert(oid)
 	}
 	//logf("uidHash %v", uidHash)
 	uids := make([]int32, 0, limit)
+	var scores []float64
+	if withScore {
+		scores = make([]float64, 0, limit)
+	}
 Outter:
 	for len(groups) > 0 {
 		cnt := groups[0]
@@ -1235,6 +1532,9 @@ Outter:
 				continue
 			}
 			uids = append(uids, oid)
+			if withScore {
+				scores = append(scores, cnt.s)
+			}
 			if len(uids) == limit {
 				break Outter
 			}
@@ -1249,7 +1549,12 @@ Outter:
 	outFields := OutFields{Status: true, Fname: true, Sname: true,
 		Country: false}
 	for i, id := range uids {
-		outAccount(&outFields, RefAccount(id), stream)
+		outAccountFields(&outFields, RefAccount(id), stream)
+		if withScore {
+			stream.Write([]byte(`,"score":`))
+			stream.WriteFloat64(scores[i])
+		}
+		stream.WriteObjectEnd()
 		if i != len(uids)-1 {
 			stream.WriteMore()
 		}
@@ -1259,6 +1564,40 @@ Outter:
 	jsonConfig.ReturnStream(stream)
 }
 
+const (
+	SuggestDefault = "default"
+	SuggestJaccard = "jaccard"
+	SuggestCosine  = "cosine"
+	SuggestDecay   = "decay"
+
+	SuggestHalfLife = 30 * 24 * 3600
+)
+
+// outSimilar outputs similar users themselves with their scores.
+func outSimilar(ctx *Request, groups []suggestCounter, id int32, limit int) {
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"accounts":[`))
+	outFields := OutFields{Status: true, Fname: true, Sname: true}
+	for n := 0; n < limit && len(groups) > 0; groups = CntPop(groups) {
+		// account is always similar to itself
+		if int32(groups[0].u) == id {
+			continue
+		}
+		if n != 0 {
+			stream.WriteMore()
+		}
+		outAccountFields(&outFields, RefAccount(int32(groups[0].u)), stream)
+		stream.Write([]byte(`,"score":`))
+		stream.WriteFloat64(groups[0].s)
+		stream.WriteObjectEnd()
+		n++
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
+
 func doRecommend(ctx *Request, iid int) {
 	id := int32(iid)
 	if int(id) != iid {
@@ -1273,9 +1612,14 @@ func doRecommend(ctx *Request, iid int) {
 	}
 
 	var maps []bitmap.IBitmap
+	var filters []func(int32, *Account) bool
 	correct := true
 	emptyRes := false
 	limit := -1
+	withScore := false
+	scorer, _ := GetRecScorer(*recScoring)
+	ages := newFilterQuery()
+	defer ages.release()
 
 	ctx.VisitArgs(func(key string, val string) {
 		if !correct {
@@ -1293,6 +1637,12 @@ func doRecommend(ctx *Request, iid int) {
 				logf("limit: %s", err)
 				correct = false
 			}
+		case "scoring":
+			var ok bool
+			if scorer, ok = GetRecScorer(sval); !ok {
+				logf("scoring %s unknown", sval)
+				correct = false
+			}
 		case "country":
 			if len(sval) == 0 {
 				correct = false
@@ -1317,6 +1667,106 @@ func doRecommend(ctx *Request, iid int) {
 				return
 			}
 			maps = append(maps, CityStrings.GetMap(ix))
+		case "birth_gt":
+			n, err := strconv.Atoi(sval)
+			if err != nil {
+				logf("birth_gt incorrect")
+				correct = false
+				return
+			}
+			birth := int32(n)
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return acc.Birth > birth
+			})
+			// out of indexed years filter alone is enough
+			birthYear := GetBirthYear(birth)
+			if birthYear < 0 || int(birthYear) >= len(BirthYearIndexes) {
+				return
+			}
+			orIters := make([]bitmap.IBitmap, 0, len(BirthYearIndexes)-int(birthYear)+1)
+			for ; int(birthYear) < len(BirthYearIndexes); birthYear++ {
+				orIters = append(orIters, &BirthYearIndexes[birthYear])
+			}
+			maps = append(maps, bitmap.NewOrBitmap(orIters))
+		case "birth_lt":
+			n, err := strconv.Atoi(sval)
+			if err != nil {
+				logf("birth_lt incorrect")
+				correct = false
+				return
+			}
+			birth := int32(n)
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return acc.Birth < birth
+			})
+			birthYear := GetBirthYear(birth)
+			if birthYear < 0 || int(birthYear) >= len(BirthYearIndexes) {
+				return
+			}
+			orIters := make([]bitmap.IBitmap, 0, birthYear+1)
+			for ; birthYear >= 0; birthYear-- {
+				orIters = append(orIters, &BirthYearIndexes[birthYear])
+			}
+			maps = append(maps, bitmap.NewOrBitmap(orIters))
+		case "status_eq":
+			switch sval {
+			case StatusFree:
+				maps = append(maps, &FreeMap)
+			case StatusMeeting:
+				maps = append(maps, &MeetingMap)
+			case StatusComplex:
+				maps = append(maps, &ComplexMap)
+			default:
+				logf("status_eq incorrect")
+				correct = false
+			}
+		case "premium_now":
+			switch sval {
+			case "1":
+				maps = append(maps, &PremiumNow)
+			case "0":
+			default:
+				logf("premium_now incorrect")
+				correct = false
+			}
+		case "interests_contains":
+			if len(sval) == 0 {
+				correct = false
+				return
+			}
+			for _, interest := range strings.Split(sval, ",") {
+				ix := InterestStrings.Find(interest)
+				if ix == 0 {
+					emptyRes = true
+					return
+				}
+				maps = append(maps, InterestStrings.GetMap(ix))
+			}
+		case "exclude_liked":
+			switch sval {
+			case "1":
+				liked := bitmap.GetSmall(&acc.Likes)
+				filters = append(filters, func(uid int32, _ *Account) bool {
+					return !liked.Has(uid)
+				})
+			case "0":
+			default:
+				logf("exclude_liked incorrect")
+				correct = false
+			}
+		case "age_gt", "age_lt", "age_eq":
+			ages.addAgeArg(skey, sval)
+			correct = ages.correct
+			emptyRes = emptyRes || ages.emptyRes
+		case "with_score":
+			switch sval {
+			case "1":
+				withScore = true
+			case "0":
+			default:
+				logf("with_score incorrect")
+				correct = false
+			}
 		case "query_id":
 			// ignore
 		default:
@@ -1324,6 +1774,7 @@ func doRecommend(ctx *Request, iid int) {
 			correct = false
 		}
 	})
+	maps = append(maps, ages.maps...)
 	logf("correct %v limit %d maps %v", correct, limit, maps)
 
 	if !correct || limit <= 0 {
@@ -1353,21 +1804,33 @@ func doRecommend(ctx *Request, iid int) {
 	//rmap := bitmap.NewAndBitmap(maps)
 
 	recs := Recommends{
-		Birth: acc.Birth,
-		Limit: limit,
+		Birth:  acc.Birth,
+		Limit:  limit,
+		Me:     acc,
+		Scorer: scorer,
 	}
 
-	tmaps := []bitmap.IBitmap{
-		bitmap.NewAndBitmap(append(maps, &PremiumNow, &FreeMap)),
-		bitmap.NewAndBitmap(append(maps, &PremiumNow, &ComplexMap)),
-		bitmap.NewAndBitmap(append(maps, &PremiumNow, &MeetingMap)),
-		bitmap.NewAndBitmap(append(maps, &PremiumNotNow, &FreeMap)),
-		bitmap.NewAndBitmap(append(maps, &PremiumNotNow, &MeetingOrComplexMap)),
+	var tmaps []bitmap.IBitmap
+	if scorer == nil {
+		// classic order: every pass is strictly better than next one
+		tmaps = []bitmap.IBitmap{
+			bitmap.NewAndBitmap(append(maps, &PremiumNow, &FreeMap)),
+			bitmap.NewAndBitmap(append(maps, &PremiumNow, &ComplexMap)),
+			bitmap.NewAndBitmap(append(maps, &PremiumNow, &MeetingMap)),
+			bitmap.NewAndBitmap(append(maps, &PremiumNotNow, &FreeMap)),
+			bitmap.NewAndBitmap(append(maps, &PremiumNotNow, &MeetingOrComplexMap)),
+		}
+	} else {
+		tmaps = []bitmap.IBitmap{bitmap.NewAndBitmap(maps)}
 	}
 
+	filter := combineFilters(filters)
 	for _, tmap := range tmaps {
 		bitmap.Loop(tmap, func(uids []int32) bool {
 			for _, uid := range uids {
+				if filter != nil && !filter(uid, RefAccount(uid)) {
+					continue
+				}
 				cnt := interests.IntersectCount(*GetInterest(uid))
 				othacc := GetSmallAccount(uid)
 				recs.Add(othacc, uid, cnt)
@@ -1381,10 +1844,10 @@ func doRecommend(ctx *Request, iid int) {
 
 	recs.Heapify()
 
-	uids := make([]int32, len(recs.Accs))
-	l := len(uids) - 1
-	for i := range uids {
-		uids[l-i] = recs.Accs[0].Uid
+	els := make([]RecElem, len(recs.Accs))
+	l := len(els) - 1
+	for i := range els {
+		els[l-i] = recs.Accs[0]
 		recs.Pop()
 	}
 
@@ -1394,9 +1857,21 @@ func doRecommend(ctx *Request, iid int) {
 	outFields := OutFields{Status: true, Fname: true, Sname: true, Birth: true,
 		Premium: true,
 		Country: false}
-	for i, id := range uids {
-		outAccount(&outFields, RefAccount(id), stream)
-		if i != len(uids)-1 {
+	for i, el := range els {
+		outAccountFields(&outFields, RefAccount(el.Uid), stream)
+		if withScore {
+			stream.Write([]byte(`,"commons":`))
+			stream.WriteUint32(el.Commons)
+			stream.Write([]byte(`,"birth_delta":`))
+			stream.WriteUint32(birthDistance(acc.Birth, el.Birth))
+			if scorer != nil {
+				stream.Write([]byte(`,"score":`))
+				stream.WriteInt64(el.Score)
+			}
+			outSharedInterests(interests.Intersect(*GetInterest(el.Uid)), stream)
+		}
+		stream.WriteObjectEnd()
+		if i != len(els)-1 {
 			stream.WriteMore()
 		}
 	}
@@ -1405,7 +1880,27 @@ func doRecommend(ctx *Request, iid int) {
 	jsonConfig.ReturnStream(stream)
 }
 
+func outSharedInterests(shared InterestMask, stream *jsoniter.Stream) {
+	stream.Write([]byte(`,"shared_interests":[`))
+	first := true
+	shared.Unroll(func(ix int32) {
+		if !first {
+			stream.WriteMore()
+		}
+		first = false
+		stream.WriteString(InterestStrings.GetStr(uint32(ix)))
+	})
+	stream.WriteArrayEnd()
+}
+
 func outAccount(out *OutFields, acc *Account, stream *jsoniter.Stream) {
+	outAccountFields(out, acc, stream)
+	stream.WriteObjectEnd()
+}
+
+// outAccountFields writes account object without closing brace, so caller
+// could add extra fields.
+func outAccountFields(out *OutFields, acc *Account, stream *jsoniter.Stream) {
 	stream.Write([]byte(`{"id":`))
 	stream.WriteInt32(acc.Uid)
 
@@ -1413,7 +1908,7 @@ func outAccount(out *OutFields, acc *Account, stream *jsoniter.Stream) {
 		stream.Write([]byte(`,"premium":{"start":`))
 		stream.WriteInt32(acc.PremiumStart)
 		stream.Write([]byte(`,"finish":`))
-		stream.WriteInt32(acc.PremiumStart + PremiumLengths[acc.PremiumLength])
+		stream.WriteInt32(acc.PremiumFinish())
 		stream.WriteObjectEnd()
 	}
 
@@ -1461,7 +1956,6 @@ func outAccount(out *OutFields, acc *Account, stream *jsoniter.Stream) {
 		stream.Write([]byte(`,"joined":`))
 		stream.WriteInt32(acc.Joined)
 	}
-	stream.WriteObjectEnd()
 }
 
 func combineFilters(filters []func(int32, *Account) bool) func(int32, *Account) bool {
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// accInterests returns interest names of account.
+func accInterests(uid int32) map[string]bool {
+	res := make(map[string]bool)
+	GetInterest(uid).Unroll(func(ix int32) {
+		res[InterestStrings.GetStr(uint32(ix))] = true
+	})
+	return res
+}
+
+func TestInterestsMinMatch(t *testing.T) {
+	loadFixture(t)
+	names := []string{"кино", "музыка", "спорт", "книги"}
+	anyArg := url.QueryEscape("кино,музыка,спорт,книги,нет такого")
+	for n := 1; n <= 5; n++ {
+		want := bruteIds(30, func(acc *Account) bool {
+			has := accInterests(acc.Uid)
+			cnt := 0
+			for _, s := range names {
+				if has[s] {
+					cnt++
+				}
+			}
+			return cnt >= n
+		})
+		// interests_min_match may come before or after interests_any
+		args := fmt.Sprintf("interests_any=%s&interests_min_match=%d&limit=30", anyArg, n)
+		require.Equal(t, want, filterIds(t, args), args)
+		args = fmt.Sprintf("interests_min_match=%d&interests_any=%s&limit=30", n, anyArg)
+		require.Equal(t, want, filterIds(t, args), args)
+	}
+
+	for _, args := range []string{
+		"interests_min_match=2&limit=5",
+		"interests_min_match=0&interests_any=" + anyArg + "&limit=5",
+		"interests_min_match=x&interests_any=" + anyArg + "&limit=5",
+	} {
+		code, _ := serve(t, "GET", "/accounts/filter/?"+args, "")
+		require.Equal(t, 400, code, args)
+	}
+	// unknown interests only: interests_any is present, result is empty
+	require.Empty(t, filterIds(t, "interests_any=zzz&interests_min_match=1&limit=5"))
+}
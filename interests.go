@@ -9,6 +9,30 @@ import (
 type InterestBlock [16]uint8
 type InterestMask [2]uint64
 
+// MaxInterests is number of interest ids InterestMask and interest group
+// counters have room for. Ids of merged and retired interests are not
+// reused until dictionaries are compacted.
+const MaxInterests = 100
+
+// InterestsFit reports whether new interests among names could get ids.
+// It must be called under globMutex held exclusively, until they are added.
+func InterestsFit(names []string) bool {
+	n := len(InterestStrings.Arr)
+	for i, name := range names {
+		if InterestStrings.Find(name) != 0 {
+			continue
+		}
+		dup := false
+		for _, prev := range names[:i] {
+			dup = dup || prev == name
+		}
+		if !dup {
+			n++
+		}
+	}
+	return n <= MaxInterests
+}
+
 var Interests = make([]InterestMask, Init)
 
 func GetInterest(i int32) *InterestMask {
@@ -32,6 +56,14 @@ func (bl *InterestMask) Set(ix uint8) {
 	bitmap3.Set(bl[:], int32(ix))
 }
 
+func (bl *InterestMask) Unset(ix uint8) {
+	bitmap3.Unset(bl[:], int32(ix))
+}
+
+func (bl *InterestMask) Has(ix uint8) bool {
+	return bitmap3.Has(bl[:], int32(ix))
+}
+
 func SetInterest(i int32, ix uint8) {
 	bitmap3.Set(Interests[i][:], int32(ix))
 }
@@ -64,3 +96,11 @@ func (mi InterestMask) IntersectCount(mo InterestMask) uint32 {
 	return uint32(bits.OnesCount64(mi[0]&mo[0]) +
 		bits.OnesCount64(mi[1]&mo[1]))
 }
+
+func (mi InterestMask) Contains(mo InterestMask) bool {
+	return mi[0]&mo[0] == mo[0] && mi[1]&mo[1] == mo[1]
+}
+
+func (mi InterestMask) Intersect(mo InterestMask) InterestMask {
+	return InterestMask{mi[0] & mo[0], mi[1] & mo[1]}
+}
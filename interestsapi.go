@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// dictMutex is held shared by GET handlers while they use dictionary ids
+// and exclusively by CompactDicts, which renumbers them, and by interest
+// rename, merge and retire, which rehash interest table. Writers are
+// excluded by globMutex.
+var dictMutex sync.RWMutex
+
+// interestsHandler serves interest dictionary management:
+//
+//	GET  /interests/         - list interests with member counts
+//	POST /interests/rename/  - {"from":"a","to":"b"}, b must be new
+//	POST /interests/merge/   - {"from":"a","to":"b"}, moves members of a to b
+//	POST /interests/retire/  - retires all interests without members
+func interestsHandler(ctx *Request, path string) {
+	switch {
+	case ctx.Method == "GET" && path == "":
+		doInterestsList(ctx)
+	case ctx.Method == "POST" && (path == "rename/" || path == "merge/"):
+		doInterestsMove(ctx, path == "merge/")
+	case ctx.Method == "POST" && path == "retire/":
+		doInterestsRetire(ctx)
+	default:
+		ctx.SetStatusCode(404)
+	}
+}
+
+// liveInterests returns ids of interests which are not retired, sorted by
+// name.
+func liveInterests() []uint32 {
+	ids := make([]uint32, 0, len(InterestStrings.Arr))
+	for i := range InterestStrings.Arr {
+		if ix := uint32(i + 1); !InterestStrings.IsDead(ix) {
+			ids = append(ids, ix)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return InterestStrings.GetStr(ids[i]) < InterestStrings.GetStr(ids[j])
+	})
+	return ids
+}
+
+func doInterestsList(ctx *Request) {
+	globMutex.RLock()
+	defer globMutex.RUnlock()
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"interests":[`))
+	ids := liveInterests()
+	for i, ix := range ids {
+		stream.Write([]byte(`{"interest":`))
+		stream.WriteString(InterestStrings.GetStr(ix))
+		stream.Write([]byte(`,"count":`))
+		stream.WriteUint32(InterestStrings.GetMap(ix).Count())
+		stream.WriteObjectEnd()
+		if i != len(ids)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
+
+func doInterestsMove(ctx *Request, merge bool) {
+	var from, to string
+	iter := jsonConfig.BorrowIterator(ctx.Body)
+	for fld := iter.ReadObject(); fld != "" && iter.Error == nil; fld = iter.ReadObject() {
+		switch fld {
+		case "from":
+			from = iter.ReadString()
+		case "to":
+			to = iter.ReadString()
+		default:
+			iter.Skip()
+		}
+	}
+	err := iter.Error
+	jsonConfig.ReturnIterator(iter)
+	if err != nil || from == "" || to == "" || from == to || len(to) > 255 {
+		logf("interests move incorrect: %v", err)
+		ctx.SetStatusCode(400)
+		return
+	}
+
+	globMutex.Lock()
+	defer globMutex.Unlock()
+	fromIx := InterestStrings.Find(from)
+	if fromIx == 0 {
+		ctx.SetStatusCode(404)
+		return
+	}
+	toIx := InterestStrings.Find(to)
+	if merge != (toIx != 0) {
+		logf("interest %s exists: %v", to, toIx != 0)
+		ctx.SetStatusCode(400)
+		return
+	}
+	dictMutex.Lock()
+	if merge {
+		MergeInterest(fromIx, toIx)
+		InterestStrings.Remove(fromIx)
+	} else {
+		InterestStrings.Rename(fromIx, to)
+	}
+	dictMutex.Unlock()
+	BumpCacheGen()
+	ctx.SetStatusCode(202)
+	ctx.SetBody([]byte("{}"))
+}
+
+// MergeInterest moves members of interest from to interest to, fixing
+// interest masks and interest group counters. Interest from stays empty.
+func MergeInterest(from, to uint32) {
+	mfrom := InterestStrings.GetMap(from)
+	uids := make([]int32, 0, mfrom.Count())
+	bitmap.Loop(mfrom, func(u []int32) bool {
+		uids = append(uids, u...)
+		return true
+	})
+	for _, uid := range uids {
+		acc := RefAccount(uid)
+		mask := GetInterest(uid)
+		jyear, byear := GetJoinYear(acc.Joined), GetBirthYear(acc.Birth)
+
+		mask.Unset(uint8(from))
+		InterestStrings.Unset(from, uid)
+		InterestJoinedGroups[jyear][from-1]--
+		InterestBirthGroups[byear][from-1]--
+		InterestCountryGroups[acc.Country][from-1]--
+		if !mask.Has(uint8(to)) {
+			mask.Set(uint8(to))
+			InterestStrings.Set(to, uid)
+			InterestJoinedGroups[jyear][to-1]++
+			InterestBirthGroups[byear][to-1]++
+			InterestCountryGroups[acc.Country][to-1]++
+		}
+		InterestsCount.Set(uid, mask.IntersectCount(*mask))
+	}
+}
+
+func doInterestsRetire(ctx *Request) {
+	globMutex.Lock()
+	defer globMutex.Unlock()
+
+	retired := []string{}
+	dictMutex.Lock()
+	for _, ix := range liveInterests() {
+		if InterestStrings.GetMap(ix).Count() == 0 {
+			InterestStrings.Remove(ix)
+			retired = append(retired, InterestStrings.GetStr(ix))
+		}
+	}
+	dictMutex.Unlock()
+	if len(retired) > 0 {
+		BumpCacheGen()
+	}
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"retired":`))
+	stream.WriteVal(retired)
+	stream.WriteObjectEnd()
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAccount posts new account with interests and returns status.
+func newTestAccount(t *testing.T, id int32, interests ...string) int {
+	sex := "fm"[id%2 : id%2+1]
+	ints, _ := json.Marshal(interests)
+	body := fmt.Sprintf(`{"id":%d,"email":"new%d@test.ru","sex":"%s","birth":600000000,`+
+		`"joined":1400000000,"status":"%s","country":"Россия","interests":%s}`,
+		id, id, sex, StatusFree, ints)
+	code, _ := serve(t, "POST", "/accounts/new/", body)
+	return code
+}
+
+func setTestInterests(t *testing.T, id int32, interests ...string) int {
+	ints, _ := json.Marshal(interests)
+	code, _ := serve(t, "POST", fmt.Sprintf("/accounts/%d/", id), `{"interests":`+string(ints)+`}`)
+	return code
+}
+
+// interestsList returns /interests/ response as map from name to count.
+func interestsList(t *testing.T) map[string]int {
+	code, body := serve(t, "GET", "/interests/", "")
+	require.Equal(t, 200, code, body)
+	var res struct {
+		Interests []struct {
+			Interest string `json:"interest"`
+			Count    int    `json:"count"`
+		} `json:"interests"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	counts := make(map[string]int)
+	for _, it := range res.Interests {
+		counts[it.Interest] = it.Count
+	}
+	return counts
+}
+
+// interestGroups returns counts of /accounts/group/?keys=interests.
+func interestGroups(t *testing.T, args string) map[string]int {
+	code, body := serve(t, "GET", "/accounts/group/?keys=interests&order=-1&limit=200&"+args, "")
+	require.Equal(t, 200, code, "%s: %s", args, body)
+	var res struct {
+		Groups []struct {
+			Interests string `json:"interests"`
+			Count     int    `json:"count"`
+		} `json:"groups"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	counts := make(map[string]int)
+	for _, g := range res.Groups {
+		counts[g.Interests] = g.Count
+	}
+	return counts
+}
+
+// bruteInterests counts interests of accounts matched by f by their masks.
+func bruteInterests(f func(acc *Account) bool) map[string]int {
+	counts := make(map[string]int)
+	for uid := int32(1); uid < MaxId; uid++ {
+		if acc := HasAccount(uid); acc != nil && f(acc) {
+			for name := range accInterests(uid) {
+				counts[name]++
+			}
+		}
+	}
+	return counts
+}
+
+func year(ts int32) int {
+	return time.Unix(int64(ts), 0).UTC().Year()
+}
+
+// checkInterests compares interest list, groups and filters with counts
+// computed from interest masks of accounts.
+func checkInterests(t *testing.T) {
+	all := bruteInterests(func(*Account) bool { return true })
+	require.Equal(t, all, nonZero(interestsList(t)))
+	require.Equal(t, all, interestGroups(t, ""))
+
+	cases := []struct {
+		args string
+		f    func(acc *Account) bool
+	}{
+		{"joined=2014", func(acc *Account) bool { return year(acc.Joined) == 2014 }},
+		{"birth=1990", func(acc *Account) bool { return year(acc.Birth) == 1990 }},
+		{"country=" + url.QueryEscape("Англия"), func(acc *Account) bool {
+			return CountryStrings.GetStr(uint32(acc.Country)) == "Англия"
+		}},
+		{"joined=2012&sex=f", func(acc *Account) bool { return year(acc.Joined) == 2012 && !acc.Sex }},
+	}
+	for _, c := range cases {
+		require.Equal(t, bruteInterests(c.f), interestGroups(t, c.args), c.args)
+	}
+
+	for name := range all {
+		want := bruteIds(20, func(acc *Account) bool { return accInterests(acc.Uid)[name] })
+		require.Equal(t, want, filterIds(t, "interests_contains="+url.QueryEscape(name)+"&limit=20"), name)
+	}
+}
+
+func nonZero(m map[string]int) map[string]int {
+	for k, v := range m {
+		if v == 0 {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+func moveInterest(t *testing.T, op, from, to string) int {
+	body, _ := json.Marshal(map[string]string{"from": from, "to": to})
+	code, _ := serve(t, "POST", "/interests/"+op+"/", string(body))
+	return code
+}
+
+func TestInterestsAPI(t *testing.T) {
+	loadFixture(t)
+	checkInterests(t)
+	before := interestsList(t)
+
+	// rename keeps id and members
+	require.Equal(t, 202, moveInterest(t, "rename", "кино", "cinema"))
+	list := interestsList(t)
+	require.NotContains(t, list, "кино")
+	require.Equal(t, before["кино"], list["cinema"])
+	require.Empty(t, filterIds(t, "interests_contains="+url.QueryEscape("кино")+"&limit=5"))
+	checkInterests(t)
+	require.Equal(t, 404, moveInterest(t, "rename", "кино", "movies"))
+	require.Equal(t, 400, moveInterest(t, "rename", "cinema", "пиво"))
+	require.Equal(t, 400, moveInterest(t, "rename", "cinema", ""))
+
+	// merge moves members, accounts having both are counted once
+	union := bruteInterests(func(acc *Account) bool {
+		has := accInterests(acc.Uid)
+		return has["вино"] || has["пиво"]
+	})
+	both := bruteInterests(func(acc *Account) bool {
+		has := accInterests(acc.Uid)
+		return has["вино"] && has["пиво"]
+	})
+	require.Equal(t, 202, moveInterest(t, "merge", "вино", "пиво"))
+	list = interestsList(t)
+	require.NotContains(t, list, "вино")
+	require.Equal(t, union["вино"]+union["пиво"]-both["пиво"], list["пиво"])
+	checkInterests(t)
+	require.Equal(t, 400, moveInterest(t, "merge", "пиво", "absent"))
+
+	// retire drops interests without members only
+	require.Equal(t, 201, newTestAccount(t, fixtureSize+1, "редкое", "cinema"))
+	require.Equal(t, 1, interestsList(t)["редкое"])
+	checkInterests(t)
+	require.Equal(t, 202, setTestInterests(t, fixtureSize+1, "cinema"))
+	code, body := serve(t, "POST", "/interests/retire/", "")
+	require.Equal(t, 200, code)
+	require.JSONEq(t, `{"retired":["редкое"]}`, body)
+	require.NotContains(t, interestsList(t), "редкое")
+	checkInterests(t)
+	_, body = serve(t, "POST", "/interests/retire/", "")
+	require.JSONEq(t, `{"retired":[]}`, body)
+
+	// other tests look interests up by fixture names
+	require.Equal(t, 202, moveInterest(t, "rename", "cinema", "кино"))
+	checkInterests(t)
+}
+
+func TestInterestsCapacity(t *testing.T) {
+	loadFixture(t)
+	id := int32(fixtureSize + 10)
+	var names []string
+	for i := 0; len(InterestStrings.Arr) < MaxInterests; i++ {
+		name := fmt.Sprintf("cap%d", i)
+		require.Equal(t, 201, newTestAccount(t, id, name))
+		names = append(names, name)
+		id++
+	}
+	require.Equal(t, 400, newTestAccount(t, id, "one more"))
+	require.Equal(t, 400, setTestInterests(t, id-1, "one more"))
+	// known interests are still accepted
+	require.Equal(t, 201, newTestAccount(t, id, names[0], names[1]))
+	id++
+
+	// retired ids are not reused until compaction
+	require.Equal(t, 202, setTestInterests(t, id-2, names[0]))
+	_, body := serve(t, "POST", "/interests/retire/", "")
+	require.Contains(t, body, names[len(names)-1])
+	require.Equal(t, 400, newTestAccount(t, id, "one more"))
+	code, _ := serve(t, "POST", "/dict_gc", "")
+	require.Equal(t, 200, code)
+	require.Equal(t, 201, newTestAccount(t, id, "one more"))
+	require.True(t, len(InterestStrings.Arr) <= MaxInterests)
+	require.Contains(t, interestsList(t), "one more")
+	checkInterests(t)
+}
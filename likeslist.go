@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// doLikesList outputs accounts liked by id (likers == false) or accounts
+// who liked id (likers == true) with latest like timestamp, most recent
+// first. Repeated likes are reported with their count and average ts.
+func doLikesList(ctx *Request, iid int, likers bool) {
+	id := int32(iid)
+	if int(id) != iid {
+		ctx.SetStatusCode(404)
+		return
+	}
+
+	acc := HasAccount(id)
+	if acc == nil {
+		ctx.SetStatusCode(404)
+		return
+	}
+
+	correct := true
+	limit := -1
+	offset := 0
+	tsGt := int32(-1 << 31)
+	tsLt := int32(1<<31 - 1)
+
+	ctx.VisitArgs(func(key string, val string) {
+		if !correct {
+			return
+		}
+		switch key {
+		case "limit":
+			var err error
+			limit, err = strconv.Atoi(val)
+			if err != nil || limit == 0 {
+				logf("limit: %s", err)
+				correct = false
+			}
+		case "offset":
+			var err error
+			offset, err = strconv.Atoi(val)
+			if err != nil || offset < 0 {
+				logf("offset: %s", err)
+				correct = false
+			}
+		case "ts_gt", "ts_lt":
+			n, err := strconv.ParseInt(val, 10, 32)
+			if err != nil {
+				logf("%s incorrect", key)
+				correct = false
+				return
+			}
+			if key == "ts_gt" {
+				tsGt = int32(n)
+			} else {
+				tsLt = int32(n)
+			}
+		case "query_id":
+			// ignore
+		default:
+			logf("default incorrect")
+			correct = false
+		}
+	})
+
+	if !correct || limit <= 0 {
+		ctx.SetStatusCode(400)
+		return
+	}
+
+	var elems []bitmap.LikeStat
+	add := func(st bitmap.LikeStat) bool {
+		if st.Latest > tsGt && st.Latest < tsLt {
+			elems = append(elems, st)
+		}
+		return true
+	}
+	if likers {
+		if l := GetLikers(id); l != nil {
+			l.Stats(add)
+		}
+	} else {
+		small := bitmap.GetSmall(&acc.Likes)
+		if small.SmallImpl != nil {
+			for _, oid := range small.Data[:small.Size] {
+				// likers of oid are created after my likes are updated,
+				// so concurrent like may miss them yet
+				l := GetLikers(oid)
+				if l == nil {
+					continue
+				}
+				st, _ := l.Stat(id)
+				st.Uid = oid
+				add(st)
+			}
+		}
+	}
+
+	sort.Slice(elems, func(i, j int) bool {
+		if elems[i].Latest != elems[j].Latest {
+			return elems[i].Latest > elems[j].Latest
+		}
+		return elems[i].Uid > elems[j].Uid
+	})
+	if offset >= len(elems) {
+		elems = nil
+	} else {
+		elems = elems[offset:]
+	}
+	if len(elems) > limit {
+		elems = elems[:limit]
+	}
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"accounts":[`))
+	for i, st := range elems {
+		stream.Write([]byte(`{"id":`))
+		stream.WriteInt32(st.Uid)
+		stream.Write([]byte(`,"ts":`))
+		stream.WriteInt32(st.Latest)
+		if st.Count > 1 {
+			stream.Write([]byte(`,"count":`))
+			stream.WriteInt32(st.Count)
+			stream.Write([]byte(`,"avg_ts":`))
+			stream.WriteInt32(st.Avg)
+		}
+		stream.WriteObjectEnd()
+		if i != len(elems)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type likeListItem struct {
+	Id    int32 `json:"id"`
+	Ts    int32 `json:"ts"`
+	Count int32 `json:"count"`
+	AvgTs int32 `json:"avg_ts"`
+}
+
+// likeItem returns history of likes from uid to whom as listed by handlers.
+func likeItem(uid, whom int32) likeListItem {
+	likers := GetLikers(whom)
+	var item likeListItem
+	var sum int64
+	for _, el := range likers.Data[:likers.Size] {
+		if el.Uid == uid {
+			item.Count++
+			sum += int64(el.Ts)
+			if el.Ts > item.Ts {
+				item.Ts = el.Ts
+			}
+		}
+	}
+	if item.Count == 0 {
+		panic(fmt.Sprintf("no like %d -> %d", uid, whom))
+	}
+	if item.Count > 1 {
+		item.AvgTs = int32(sum / int64(item.Count))
+	} else {
+		item.Count = 0
+	}
+	return item
+}
+
+// bruteLikesList lists likes of id or likers of id by scanning all accounts.
+func bruteLikesList(id int32, likers bool) []likeListItem {
+	var res []likeListItem
+	if likers {
+		for uid := int32(1); uid < MaxId; uid++ {
+			for _, whom := range likesOf(uid) {
+				if whom == id {
+					item := likeItem(uid, id)
+					item.Id = uid
+					res = append(res, item)
+				}
+			}
+		}
+	} else {
+		for _, whom := range likesOf(id) {
+			item := likeItem(id, whom)
+			item.Id = whom
+			res = append(res, item)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Ts != res[j].Ts {
+			return res[i].Ts > res[j].Ts
+		}
+		return res[i].Id > res[j].Id
+	})
+	return res
+}
+
+func likesList(t *testing.T, id int32, kind string, args string) []likeListItem {
+	uri := fmt.Sprintf("/accounts/%d/%s/?%s", id, kind, args)
+	code, body := serve(t, "GET", uri, "")
+	require.Equal(t, 200, code, "%s: %s", uri, body)
+	var res struct {
+		Accounts []likeListItem `json:"accounts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	return res.Accounts
+}
+
+func TestLikesList(t *testing.T) {
+	loadFixture(t)
+
+	// repeated likes are listed once with their count and average
+	for _, ts := range []int{1530000000, 1530000100, 1530000020} {
+		body := fmt.Sprintf(`{"likes":[{"likee":250,"liker":150,"ts":%d}]}`, ts)
+		code, resp := serve(t, "POST", "/accounts/likes/", body)
+		require.Equal(t, 202, code, resp)
+	}
+	require.Contains(t, likesList(t, 150, "likes", "limit=100"),
+		likeListItem{Id: 250, Ts: 1530000100, Count: 3, AvgTs: 1530000040})
+	require.Contains(t, likesList(t, 250, "likers", "limit=100"),
+		likeListItem{Id: 150, Ts: 1530000100, Count: 3, AvgTs: 1530000040})
+
+	windows := []struct{ gt, lt int32 }{
+		{0, 0},
+		{1500000300, 0},
+		{0, 1500000700},
+		{1500000200, 1500000800},
+	}
+	checked := 0
+	for id := int32(1); id <= fixtureSize; id += 7 {
+		for _, kind := range []string{"likes", "likers"} {
+			all := bruteLikesList(id, kind == "likers")
+			if len(all) == 0 {
+				require.Empty(t, likesList(t, id, kind, "limit=5"), "%d %s", id, kind)
+				continue
+			}
+			checked++
+			for _, w := range windows {
+				var window []likeListItem
+				args := ""
+				for _, item := range all {
+					if (w.gt == 0 || item.Ts > w.gt) && (w.lt == 0 || item.Ts < w.lt) {
+						window = append(window, item)
+					}
+				}
+				if w.gt != 0 {
+					args += fmt.Sprintf("ts_gt=%d&", w.gt)
+				}
+				if w.lt != 0 {
+					args += fmt.Sprintf("ts_lt=%d&", w.lt)
+				}
+				for _, page := range []struct{ offset, limit int }{{0, 1}, {0, 10}, {1, 2}, {3, 10}} {
+					want := []likeListItem{}
+					if page.offset < len(window) {
+						want = window[page.offset:]
+					}
+					if len(want) > page.limit {
+						want = want[:page.limit]
+					}
+					got := likesList(t, id, kind, fmt.Sprintf("%soffset=%d&limit=%d", args, page.offset, page.limit))
+					if len(want) == 0 {
+						require.Empty(t, got, "%d %s %s", id, kind, args)
+						continue
+					}
+					require.Equal(t, want, got, "%d %s %s %v", id, kind, args, page)
+				}
+			}
+		}
+	}
+	require.NotZero(t, checked)
+
+	for _, args := range []string{"limit=0", "limit=abc", "offset=-1&limit=5", "ts_gt=abc&limit=5", "ts_lt=99999999999&limit=5", "foo=1&limit=5"} {
+		for _, kind := range []string{"likes", "likers"} {
+			code, _ := serve(t, "GET", "/accounts/150/"+kind+"/?"+args, "")
+			require.Equal(t, 400, code, "%s %s", kind, args)
+		}
+	}
+	code, _ := serve(t, "GET", "/accounts/99999999/likers/?limit=5", "")
+	require.Equal(t, 404, code)
+	code, _ = serve(t, "GET", "/accounts/abc/likes/?limit=5", "")
+	require.Equal(t, 400, code)
+}
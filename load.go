@@ -282,10 +282,12 @@ func InsertAccount(accin *AccountIn) {
 
 	byear := GetBirthYear(acc.Birth)
 	BirthYearIndexes[byear].Set(acc.Uid)
+	BirthRange.Set(acc.Uid, acc.Birth)
 
 	acc.Joined = accin.Joined
 	jyear := GetJoinYear(acc.Joined)
 	JoinYearIndexes[jyear].Set(acc.Uid)
+	JoinedRange.Set(acc.Uid, acc.Joined)
 
 	acc.Sex = accin.Sex == "m"
 	if acc.Sex {
@@ -304,10 +306,9 @@ func InsertAccount(accin *AccountIn) {
 	if !ok {
 		panic("email is not unique " + accin.Email)
 	}
-	acc.EmailStart = GetEmailStart(accin.Email)
+	EmailSorted.Insert(acc.Email)
 	domain := DomainFromEmail(accin.Email)
 	acc.Domain = uint8(DomainsStrings.Add(domain, acc.Uid))
-	IndexGtLtEmail(accin.Email, acc.Uid, true)
 
 	acc.Phone, ok = PhoneIndex.InsertUid(accin.Phone, acc.Uid)
 	if accin.Phone != "" {
@@ -320,7 +321,6 @@ func InsertAccount(accin *AccountIn) {
 
 	acc.Fname = uint8(FnameStrings.Add(accin.Fname, acc.Uid))
 	acc.Sname = uint16(SnameStrings.Add(accin.Sname, acc.Uid))
-	SnameOnce.Reset()
 
 	acc.City = uint16(CityStrings.Add(accin.City, acc.Uid))
 	acc.Country = uint8(CountryStrings.Add(accin.Country, acc.Uid))
@@ -334,12 +334,17 @@ func InsertAccount(accin *AccountIn) {
 			PremiumNotNow.Set(acc.Uid)
 		}
 		PremiumNotNull.Set(acc.Uid)
+		PremiumStartRange.Set(acc.Uid, acc.PremiumStart)
+		PremiumFinishRange.Set(acc.Uid, acc.PremiumFinish())
 	} else {
 		PremiumNotNow.Set(acc.Uid)
 		PremiumNull.Set(acc.Uid)
 	}
 	for _, interest := range accin.Interests {
 		ix := InterestStrings.Add(interest, acc.Uid)
+		if ix > MaxInterests {
+			panic("too many interests " + interest)
+		}
 		SetInterest(acc.Uid, uint8(ix))
 		//acc.SetInterest(ix - 1)
 		InterestJoinedGroups[GetJoinYear(acc.Joined)][ix-1]++
@@ -351,7 +356,7 @@ func InsertAccount(accin *AccountIn) {
 	likes := bitmap.Small{smallImpl}
 	for _, like := range accin.Likes {
 		likes.Set(like.Id)
-		SureLikers(like.Id, func(l *bitmap.Likes) { l.SetTs(like.Id, acc.Uid, like.Ts) })
+		AddLike(like.Id, acc.Uid, like.Ts)
 	}
 	acc.Likes = likes.ForceAlloc()
 	likesImplPool.Put(smallImpl)
@@ -360,6 +365,12 @@ func InsertAccount(accin *AccountIn) {
 	CountryGroups[acc.Country][acc.StatusIx()+acc.SexIx()*3]++
 
 	SetSmallAccount(acc.Uid, acc.SmallAccount())
+	LikesCount.Sure(acc.Uid)
+	LikersCount.Sure(acc.Uid)
+	LikedCount.Sure(acc.Uid)
+	interests := GetInterest(acc.Uid)
+	InterestsCount.Set(acc.Uid, interests.IntersectCount(*interests))
+	BumpCacheGen()
 }
 
 var likesImplPool = sync.Pool{
@@ -367,6 +378,10 @@ var likesImplPool = sync.Pool{
 }
 
 func UpdateAccount(acc *Account, accin *AccountIn) bool {
+	if !InterestsFit(accin.Interests) {
+		logf("no room for new interests %v", accin.Interests)
+		return false
+	}
 	oldEmail := EmailIndex.GetStr(acc.Email)
 	updateEmail := false
 	if accin.Email != "" && oldEmail != accin.Email {
@@ -388,19 +403,18 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 
 	var ok bool
 	if updateEmail {
+		EmailSorted.Remove(acc.Email)
 		EmailIndex.ResetUser(acc.Email, acc.Uid)
 		DomainsStrings.Unset(uint32(acc.Domain), acc.Uid)
-		IndexGtLtEmail(oldEmail, acc.Uid, false)
 
 		acc.Email, ok = EmailIndex.InsertUid(accin.Email, acc.Uid)
 		if !ok {
 			panic("email is not unique " + accin.Email)
 		}
+		EmailSorted.Insert(acc.Email)
 
-		acc.EmailStart = GetEmailStart(accin.Email)
 		domain := DomainFromEmail(accin.Email)
 		acc.Domain = uint8(DomainsStrings.Add(domain, acc.Uid))
-		IndexGtLtEmail(accin.Email, acc.Uid, true)
 	}
 	if updatePhone {
 		if acc.Phone != 0 {
@@ -432,8 +446,10 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 		if byear != nbyear {
 			BirthYearIndexes[byear].Unset(acc.Uid)
 			BirthYearIndexes[nbyear].Set(acc.Uid)
-			acc.Birth = accin.Birth
 		}
+		BirthRange.Unset(acc.Uid, acc.Birth)
+		acc.Birth = accin.Birth
+		BirthRange.Set(acc.Uid, acc.Birth)
 	}
 
 	if accin.Joined != 0 {
@@ -442,8 +458,10 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 		if njyear != jyear {
 			JoinYearIndexes[jyear].Unset(acc.Uid)
 			JoinYearIndexes[njyear].Set(acc.Uid)
-			acc.Joined = accin.Joined
 		}
+		JoinedRange.Unset(acc.Uid, acc.Joined)
+		acc.Joined = accin.Joined
+		JoinedRange.Set(acc.Uid, acc.Joined)
 	}
 
 	CountryGroups[acc.Country][acc.StatusIx()+acc.SexIx()*3]--
@@ -480,9 +498,15 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 				PremiumNotNow.Unset(acc.Uid)
 			}
 		}
+		if PremiumNotNull.Has(acc.Uid) {
+			PremiumStartRange.Unset(acc.Uid, acc.PremiumStart)
+			PremiumFinishRange.Unset(acc.Uid, acc.PremiumFinish())
+		}
 		acc.PremiumStart = accin.Premium.Start
 		acc.PremiumLength = GetPremiumLength(accin.Premium.Start, accin.Premium.Finish)
 		acc.PremiumNow = accin.Premium.Start <= CurTs && accin.Premium.Finish > CurTs
+		PremiumStartRange.Set(acc.Uid, acc.PremiumStart)
+		PremiumFinishRange.Set(acc.Uid, acc.PremiumFinish())
 		PremiumNotNull.Set(acc.Uid)
 		PremiumNull.Unset(acc.Uid)
 	}
@@ -505,7 +529,6 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 			}
 			acc.Sname = uint16(SnameStrings.Add(accin.Sname, acc.Uid))
 		}
-		SnameOnce.Reset()
 	}
 
 	if accin.Sex != "" {
@@ -550,6 +573,7 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 			InterestCountryGroups[acc.Country][ix-1]++
 		}
 		SetInterests(acc.Uid, newIntersets)
+		InterestsCount.Set(acc.Uid, newIntersets.IntersectCount(newIntersets))
 	} else {
 		GetInterest(acc.Uid).Unroll(func(ix int32) {
 			InterestJoinedGroups[GetJoinYear(acc.Joined)][ix-1]++
@@ -559,6 +583,7 @@ func UpdateAccount(acc *Account, accin *AccountIn) bool {
 	}
 
 	SetSmallAccount(acc.Uid, acc.SmallAccount())
+	BumpCacheGen()
 
 	return true
 }
@@ -3,34 +3,82 @@ package main
 import (
 	"flag"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //var datazip = flag.String("data", "/tmp/data/data.zip", "data file")
 //var options = flag.String("opts", "/tmp/data/options.txt", "options file")
 var path = flag.String("path", "/tmp/data/", "data path")
-var port = flag.String("port", "80", "port to listen")
+var port = flag.String("port", "80", "port to listen (empty - only TLS)")
 var onlyload = flag.Bool("onlyload", false, "only load")
 var memprofile = flag.String("memprofile", "", "memprofile")
 var dumpload = flag.Bool("dumpload", false, "dumpload")
+var idleTimeout = flag.Duration("idle", time.Minute, "keep-alive idle timeout (0 - no timeout)")
+var readTimeout = flag.Duration("readtimeout", 5*time.Second, "timeout to receive whole request (0 - no timeout)")
+var writeTimeout = flag.Duration("writetimeout", 5*time.Second, "timeout to send response (0 - no timeout)")
+var maxConns = flag.Int("maxconns", 10000, "max open connections, 503 is sent above")
+var workers = flag.Int("workers", 0, "number of epoll workers (0 - by number of cpus)")
+var epollMode = flag.String("epoll", EpollShared, "epoll model: shared - one epoll for all workers, reuseport - epoll and SO_REUSEPORT listener per worker")
+var cpuPin = flag.Bool("cpupin", false, "pin epoll workers to cpus")
+var compress = flag.Bool("compress", true, "compress responses with gzip or deflate if client accepts it")
+var compressMin = flag.Int("compressmin", 1024, "minimal response size to compress")
+var compressLevel = flag.Int("compresslevel", 1, "compression level")
+var cacheSize = flag.Int("cachesize", 10000, "max entries in /filter/ and /group/ response cache (0 - disabled)")
+var ageGroups = flag.String("agegroups", "18,25,35,45,55,65", "ages starting /group/ age buckets")
+var recScoring = flag.String("recscoring", ScoringClassic, "default recommend scoring: classic, weighted, interests, reciprocal")
+var dictGC = flag.Duration("dictgc", 0, "period of dictionaries compaction (0 - only on POST /dict_gc)")
+var tlsCert = flag.String("tlscert", "", "TLS certificate file, enables TLS listener")
+var tlsKey = flag.String("tlskey", "", "TLS private key file")
+var tlsPort = flag.String("tlsport", "443", "port to listen with TLS")
 
 func main() {
 	log.SetFlags(log.Lmicroseconds | log.Lshortfile)
 	flag.Parse()
+	if _, err := workerCount(*workers, *epollMode); err != nil {
+		log.Fatal(err)
+	}
+	if _, ok := GetRecScorer(*recScoring); !ok {
+		log.Fatalf("unknown recommend scoring %q", *recScoring)
+	}
+	var ok bool
+	if AgeRanges, ok = ParseAgeRanges(*ageGroups); !ok {
+		log.Fatalf("incorrect age groups %q", *ageGroups)
+	}
 
 	go http.ListenAndServe("localhost:6065", nil)
 
 	Load()
+	QueryCache.Init(*cacheSize)
+	if *dictGC > 0 {
+		go RunDictGC(*dictGC)
+	}
 
 	if *onlyload {
 		return
 	}
 
+	if *tlsCert != "" || *tlsKey != "" {
+		cfg, err := LoadTLSConfig(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", ":"+*tlsPort)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *port == "" {
+			log.Fatal(ServeTLS(ln, cfg))
+		}
+		go func() { log.Fatal(ServeTLS(ln, cfg)) }()
+	}
+
 	prt, _ := strconv.Atoi(*port)
 	Acceptor(prt)
 
@@ -67,6 +115,16 @@ func myHandler(ctx *Request) error {
 			pprof.StopCPUProfile()
 			ctx.SetStatusCode(200)
 			return nil
+		} else if path == "/cache_stats" {
+			ctx.SetStatusCode(200)
+			ctx.SetBody(QueryCache.StatJSON())
+			return nil
+		} else if strings.HasPrefix(path, "/interests/") {
+			interestsHandler(ctx, path[len("/interests/"):])
+			return nil
+		} else if path == "/dict_gc" && meth == "POST" {
+			doDictGC(ctx)
+			return nil
 		} else if path == "/test" {
 			ctx.SetStatusCode(200)
 			ctx.SetBody([]byte("{}"))
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+type Match struct {
+	Uid        int32
+	TsSent     int32
+	TsReceived int32
+}
+
+func (m Match) Latest() int32 {
+	if m.TsSent > m.TsReceived {
+		return m.TsSent
+	}
+	return m.TsReceived
+}
+
+// doMatches outputs accounts with mutual likes, most recent first.
+func doMatches(ctx *Request, iid int) {
+	id := int32(iid)
+	if int(id) != iid {
+		ctx.SetStatusCode(404)
+		return
+	}
+
+	acc := HasAccount(id)
+	if acc == nil {
+		ctx.SetStatusCode(404)
+		return
+	}
+
+	var filters []func(int32, *Account) bool
+	correct := true
+	emptyRes := false
+	limit := -1
+
+	ctx.VisitArgs(func(key string, val string) {
+		if !correct {
+			return
+		}
+		switch key {
+		case "limit":
+			var err error
+			limit, err = strconv.Atoi(val)
+			if err != nil || limit == 0 {
+				logf("limit: %s", err)
+				correct = false
+			}
+		case "sex_eq":
+			var sex bool
+			switch val {
+			case "m":
+				sex = true
+			case "f":
+			default:
+				logf("sex_eq incorrect")
+				correct = false
+				return
+			}
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return acc.Sex == sex
+			})
+		case "status_eq":
+			status, ok := GetStatusIx(val)
+			if !ok {
+				logf("status_eq incorrect")
+				correct = false
+				return
+			}
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return acc.Status == status
+			})
+		case "country":
+			if len(val) == 0 {
+				correct = false
+				return
+			}
+			ix := CountryStrings.Find(val)
+			if ix == 0 {
+				emptyRes = true
+				return
+			}
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return uint32(acc.Country) == ix
+			})
+		case "city":
+			if len(val) == 0 {
+				correct = false
+				return
+			}
+			ix := CityStrings.Find(val)
+			if ix == 0 {
+				emptyRes = true
+				return
+			}
+			filters = append(filters, func(_ int32, acc *Account) bool {
+				return uint32(acc.City) == ix
+			})
+		case "premium_now":
+			switch val {
+			case "1":
+				filters = append(filters, func(_ int32, acc *Account) bool {
+					return acc.PremiumNow
+				})
+			case "0":
+			default:
+				logf("premium_now incorrect")
+				correct = false
+			}
+		case "query_id":
+			// ignore
+		default:
+			logf("default incorrect")
+			correct = false
+		}
+	})
+
+	if !correct || limit <= 0 {
+		ctx.SetStatusCode(400)
+		return
+	}
+	small := bitmap.GetSmall(&acc.Likes)
+	likers := GetLikers(id)
+	if emptyRes || small.SmallImpl == nil || likers == nil {
+		ctx.SetStatusCode(200)
+		ctx.SetBody(EmptyFilterRes)
+		return
+	}
+
+	filter := combineFilters(filters)
+	var matches []Match
+	// both lists are sorted by uid descending
+	likes := small.Data[:small.Size]
+	liked := likers.Data[:likers.Size]
+	for len(likes) > 0 && len(liked) > 0 {
+		oid := likes[0]
+		if oid > liked[0].Uid {
+			likes = likes[1:]
+			continue
+		} else if oid < liked[0].Uid {
+			liked = liked[1:]
+			continue
+		}
+		likes = likes[1:]
+		liked = liked[1:]
+		if filter != nil && !filter(oid, RefAccount(oid)) {
+			continue
+		}
+		received, _ := likers.Stat(oid)
+		m := Match{Uid: oid, TsReceived: received.Latest}
+		// concurrent like may be in my likes before likers of oid are created
+		if l := GetLikers(oid); l != nil {
+			sent, _ := l.Stat(id)
+			m.TsSent = sent.Latest
+		}
+		matches = append(matches, m)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		li, lj := matches[i].Latest(), matches[j].Latest()
+		if li != lj {
+			return li > lj
+		}
+		return matches[i].Uid > matches[j].Uid
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"accounts":[`))
+	outFields := OutFields{Sex: true, Status: true, Fname: true, Sname: true, Birth: true}
+	for i, m := range matches {
+		outAccountFields(&outFields, RefAccount(m.Uid), stream)
+		stream.Write([]byte(`,"ts_sent":`))
+		stream.WriteInt32(m.TsSent)
+		stream.Write([]byte(`,"ts_received":`))
+		stream.WriteInt32(m.TsReceived)
+		stream.WriteObjectEnd()
+		if i != len(matches)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
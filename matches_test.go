@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type matchAccount struct {
+	Id         int32 `json:"id"`
+	TsSent     int32 `json:"ts_sent"`
+	TsReceived int32 `json:"ts_received"`
+}
+
+// bruteMatches returns accounts liked by me and liking me, latest first.
+func bruteMatches(me int32, match func(*Account) bool) []matchAccount {
+	var res []matchAccount
+	for _, oid := range likesOf(me) {
+		if !match(RefAccount(oid)) {
+			continue
+		}
+		for _, whom := range likesOf(oid) {
+			if whom == me {
+				res = append(res, matchAccount{Id: oid, TsSent: likeItem(me, oid).Ts, TsReceived: likeItem(oid, me).Ts})
+				break
+			}
+		}
+	}
+	latest := func(m matchAccount) int32 {
+		if m.TsSent > m.TsReceived {
+			return m.TsSent
+		}
+		return m.TsReceived
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if li, lj := latest(res[i]), latest(res[j]); li != lj {
+			return li > lj
+		}
+		return res[i].Id > res[j].Id
+	})
+	return res
+}
+
+func matchesOf(t *testing.T, id int32, args string) []matchAccount {
+	uri := fmt.Sprintf("/accounts/%d/matches/?%s", id, args)
+	code, body := serve(t, "GET", uri, "")
+	require.Equal(t, 200, code, "%s: %s", uri, body)
+	var res struct {
+		Accounts []matchAccount `json:"accounts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	return res.Accounts
+}
+
+func TestMatches(t *testing.T) {
+	loadFixture(t)
+
+	// fixture likes are random, so make some mutual ones
+	pairs := [][2]int32{{101, 202}, {101, 304}, {101, 405}, {202, 304}}
+	for i, p := range pairs {
+		ts := 1540000000 + int32(i)*100
+		body := fmt.Sprintf(`{"likes":[{"likee":%d,"liker":%d,"ts":%d},{"likee":%d,"liker":%d,"ts":%d}]}`,
+			p[0], p[1], ts, p[1], p[0], ts+int32(i%2)*500)
+		code, resp := serve(t, "POST", "/accounts/likes/?query_id=1", body)
+		require.Equal(t, 202, code, resp)
+	}
+
+	all := func(*Account) bool { return true }
+	cases := []struct {
+		args  string
+		match func(*Account) bool
+	}{
+		{"", all},
+		{"sex_eq=m", func(acc *Account) bool { return acc.Sex }},
+		{"sex_eq=f", func(acc *Account) bool { return !acc.Sex }},
+		{"status_eq=" + StatusFree, func(acc *Account) bool { return acc.Status == StatusFreeIx }},
+		{"premium_now=1", func(acc *Account) bool { return acc.PremiumNow }},
+		{"premium_now=0", all},
+		{"city=Москва", func(acc *Account) bool {
+			return uint32(acc.City) == CityStrings.Find("Москва")
+		}},
+		{"country=Россия", func(acc *Account) bool {
+			return uint32(acc.Country) == CountryStrings.Find("Россия")
+		}},
+		{"city=Атлантида", func(*Account) bool { return false }},
+	}
+
+	found := 0
+	for id := int32(1); id <= fixtureSize; id++ {
+		if len(likesOf(id)) == 0 || GetLikers(id) == nil {
+			continue
+		}
+		if len(bruteMatches(id, all)) == 0 {
+			require.Empty(t, matchesOf(t, id, "limit=5"), "id %d", id)
+			continue
+		}
+		for _, tc := range cases {
+			for _, limit := range []int{1, 3, 20} {
+				want := bruteMatches(id, tc.match)
+				if len(want) > limit {
+					want = want[:limit]
+				}
+				args := escapeArgs(tc.args)
+				if args != "" {
+					args += "&"
+				}
+				args += fmt.Sprintf("limit=%d", limit)
+				got := matchesOf(t, id, args)
+				if len(want) == 0 {
+					require.Empty(t, got, "id %d %s", id, args)
+					continue
+				}
+				require.Equal(t, want, got, "id %d %s", id, args)
+				found += len(want)
+			}
+		}
+	}
+	require.NotZero(t, found)
+
+	got := matchesOf(t, 101, "limit=10")
+	ids := []int32{}
+	for _, m := range got {
+		ids = append(ids, m.Id)
+	}
+	require.Subset(t, ids, []int32{202, 304, 405})
+
+	for _, args := range []string{"limit=0", "limit=abc", "sex_eq=x&limit=5", "status_eq=x&limit=5", "premium_now=2&limit=5", "city=&limit=5", "foo=1&limit=5"} {
+		code, _ := serve(t, "GET", "/accounts/101/matches/?"+args, "")
+		require.Equal(t, 400, code, args)
+	}
+	code, _ := serve(t, "GET", "/accounts/99999999/matches/?limit=5", "")
+	require.Equal(t, 404, code)
+}
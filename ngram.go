@@ -0,0 +1,234 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// NgramIndex maps trigrams of normalized strings to ids of strings in
+// dictionary. Ids are inserted in increasing order, so posting lists are
+// sorted without extra work. Norms keeps normalized string of id at id-1
+// for checking candidates and for patterns too short for trigrams.
+type NgramIndex struct {
+	sync.RWMutex
+	Grams map[uint32][]uint32
+	Norms []string
+}
+
+var EmailNgrams NgramIndex
+var FnameNgrams NgramIndex
+var SnameNgrams NgramIndex
+
+func init() {
+	EmailIndex.OnInsert = EmailNgrams.Add
+	FnameStrings.OnInsert = FnameNgrams.Add
+	SnameStrings.OnInsert = SnameNgrams.Add
+}
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "h", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// NormalizeSearch lowercases s and transliterates cyrillic to latin, so
+// "Иван", "ИВАН" and "ivan" are the same for search.
+func NormalizeSearch(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		r = unicode.ToLower(r)
+		if t, ok := translit[r]; ok {
+			sb.WriteString(t)
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func trigram(s string) uint32 {
+	return uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+}
+
+func (ni *NgramIndex) Add(id uint32, s string) {
+	norm := NormalizeSearch(s)
+	ni.Lock()
+	defer ni.Unlock()
+	if ni.Grams == nil {
+		ni.Grams = make(map[uint32][]uint32)
+	}
+	for int(id) > len(ni.Norms) {
+		ni.Norms = append(ni.Norms, "")
+	}
+	ni.Norms[id-1] = norm
+	for i := 0; i+3 <= len(norm); i++ {
+		g := trigram(norm[i:])
+		list := ni.Grams[g]
+		if len(list) > 0 && list[len(list)-1] == id {
+			continue
+		}
+		ni.Grams[g] = append(list, id)
+	}
+}
+
+// Remap prepares renumbering ids by remap, dropping ids mapped to 0. Remap
+// must keep order of ids, so posting lists stay sorted. Index is changed
+// only by returned apply.
+func (ni *NgramIndex) Remap(remap []uint32) (apply func()) {
+	ni.RLock()
+	grams := make(map[uint32][]uint32, len(ni.Grams))
+	for g, list := range ni.Grams {
+		var nlist []uint32
+		for _, id := range list {
+			if nid := remap[id]; nid != 0 {
+				nlist = append(nlist, nid)
+			}
+		}
+		if len(nlist) > 0 {
+			grams[g] = nlist
+		}
+	}
+	norms := make([]string, 0, len(ni.Norms))
+	for i, norm := range ni.Norms {
+		if remap[i+1] != 0 {
+			norms = append(norms, norm)
+		}
+	}
+	ni.RUnlock()
+	return func() {
+		ni.Lock()
+		ni.Grams = grams
+		ni.Norms = norms
+		ni.Unlock()
+	}
+}
+
+// Search returns sorted ids of strings matching pattern. If like is false,
+// pattern is a plain substring. Otherwise it is LIKE pattern where '%' is
+// any sequence and '_' is any character.
+func (ni *NgramIndex) Search(pattern string, like bool) []uint32 {
+	pattern = NormalizeSearch(pattern)
+	var literals []string
+	if like {
+		literals = strings.FieldsFunc(pattern, func(r rune) bool { return r == '%' || r == '_' })
+	} else {
+		literals = []string{pattern}
+	}
+	match := func(s string) bool {
+		if like {
+			return likeMatch(s, pattern)
+		}
+		return strings.Contains(s, pattern)
+	}
+
+	ni.RLock()
+	defer ni.RUnlock()
+	var lists [][]uint32
+	for _, lit := range literals {
+		for i := 0; i+3 <= len(lit); i++ {
+			list := ni.Grams[trigram(lit[i:])]
+			if len(list) == 0 {
+				return nil
+			}
+			lists = append(lists, list)
+		}
+	}
+
+	var res []uint32
+	if len(lists) == 0 {
+		// pattern is too short for trigrams: scan whole dictionary
+		for i, norm := range ni.Norms {
+			if match(norm) {
+				res = append(res, uint32(i+1))
+			}
+		}
+		return res
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	for _, id := range lists[0] {
+		ok := true
+		for _, list := range lists[1:] {
+			ix := sort.Search(len(list), func(i int) bool { return list[i] >= id })
+			if ix == len(list) || list[ix] != id {
+				ok = false
+				break
+			}
+		}
+		if ok && match(ni.Norms[id-1]) {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// likeMatch matches s against LIKE pattern with '%' and '_' wildcards.
+func likeMatch(s, pattern string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '%':
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if likeMatch(s[i:], pattern) {
+					return true
+				}
+			}
+			return false
+		case '_':
+			if len(s) == 0 {
+				return false
+			}
+			_, sz := utf8.DecodeRuneInString(s)
+			s, pattern = s[sz:], pattern[1:]
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s, pattern = s[1:], pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// SearchMap returns bitmap of accounts owning dictionary strings matched
+// by pattern, or nil if there is none.
+func (ss *SomeStrings) SearchMap(ni *NgramIndex, pattern string, like bool) bitmap.IBitmap {
+	ids := ni.Search(pattern, like)
+	maps := make([]bitmap.IBitmap, 0, len(ids))
+	for _, id := range ids {
+		if mp := ss.GetMap(id); mp.Count() > 0 {
+			maps = append(maps, mp)
+		}
+	}
+	switch len(maps) {
+	case 0:
+		return nil
+	case 1:
+		return maps[0]
+	}
+	return bitmap.NewOrBitmap(maps)
+}
+
+// SearchUids returns accounts owning unique strings matched by pattern,
+// sorted by uid descending.
+func (us *UniqStrings) SearchUids(ni *NgramIndex, pattern string, like bool) bitmap.RawUids {
+	ids := ni.Search(pattern, like)
+	uids := make(bitmap.RawUids, 0, len(ids))
+	for _, id := range ids {
+		if uid := us.GetHndl(id).Handle; uid != 0 {
+			uids = append(uids, int32(uid))
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] > uids[j] })
+	return uids
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSearch(t *testing.T) {
+	require.Equal(t, "ivan", NormalizeSearch("Иван"))
+	require.Equal(t, "ivan", NormalizeSearch("ИВАН"))
+	require.Equal(t, "ivan", NormalizeSearch("ivan"))
+	require.Equal(t, "zhukova", NormalizeSearch("Жукова"))
+	require.Equal(t, "shchuka", NormalizeSearch("Шчука"))
+	require.Equal(t, "schuka", NormalizeSearch("щука"))
+	require.Equal(t, "obem", NormalizeSearch("Объём"))
+	require.Equal(t, "mo@mail.ru", NormalizeSearch("Mo@Mail.RU"))
+	require.Equal(t, "", NormalizeSearch(""))
+}
+
+func TestLikeMatch(t *testing.T) {
+	cases := []struct {
+		s, pattern string
+		ok         bool
+	}{
+		{"ivanov", "ivanov", true},
+		{"ivanov", "ivan", false},
+		{"ivanov", "ivan%", true},
+		{"ivanov", "%nov", true},
+		{"ivanov", "%van%", true},
+		{"ivanov", "%x%", false},
+		{"ivanov", "i_anov", true},
+		{"ivanov", "i_nov", false},
+		{"ivanov", "______", true},
+		{"ivanov", "_____", false},
+		{"ivanov", "%", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"", "", true},
+		{"a", "", false},
+		{"ivanov", "i%a%v", true},
+		{"ivanov", "i%v%a", false},
+		{"ivanov", "%%ov", true},
+		{"иван", "_ван", true},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.ok, likeMatch(c.s, c.pattern), "%q like %q", c.s, c.pattern)
+	}
+}
+
+func TestNgramSearch(t *testing.T) {
+	var st StringsTable
+	var ni NgramIndex
+	st.OnInsert = ni.Add
+	for _, s := range []string{"Иванов", "Ivanchuk", "Петров", "Петрова", "Ян", "Яна"} {
+		st.Insert(s)
+	}
+	search := func(pattern string, like bool) []string {
+		var res []string
+		for _, id := range ni.Search(pattern, like) {
+			res = append(res, st.GetStr(id))
+		}
+		return res
+	}
+
+	require.Equal(t, []string{"Иванов", "Ivanchuk"}, search("иван", false))
+	require.Equal(t, []string{"Иванов", "Ivanchuk"}, search("IVAN", false))
+	require.Equal(t, []string{"Петров", "Петрова"}, search("петров", false))
+	require.Equal(t, []string{"Иванов", "Петров"}, search("%ov", true))
+	require.Equal(t, []string{"Петрова"}, search("petr_va", true))
+	require.Equal(t, []string{"Иванов", "Петров", "Петрова"}, search("%ov%", true))
+	require.Nil(t, search("sidor", false))
+	require.Nil(t, search("iva%xyz", true))
+	// patterns shorter than trigram scan normalized strings
+	require.Equal(t, []string{"Ян", "Яна"}, search("я", false))
+	require.Equal(t, []string{"Ян"}, search("ya_", true))
+	require.Equal(t, []string{"Ivanchuk"}, search("k", false))
+
+	// remap drops ids and keeps normalized strings in sync, but only once
+	// it is applied
+	remap := []uint32{0, 1, 0, 2, 3, 4, 5}
+	apply := ni.Remap(remap)
+	require.Equal(t, []uint32{5, 6}, ni.Search("я", false))
+	apply()
+	require.Equal(t, []uint32{1}, ni.Search("иван", false))
+	require.Equal(t, []uint32{4, 5}, ni.Search("я", false))
+	require.Equal(t, []uint32{2, 3}, ni.Search("petrov", false))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"math/bits"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// CountBuckets is a number of count buckets: exact for 0..15, then one per
+// power of two.
+const CountBuckets = 16 + 28
+
+// CountIndex keeps per account counter together with bitmaps of accounts
+// bucketed by counter value, so accounts could be visited from the most
+// counted without scanning all of them.
+// It is modified under globMutex (or by loader). Counts is sized for every
+// possible uid, so lock-free readers never see it reallocated.
+type CountIndex struct {
+	Counts  [bitmap.UpLimit]uint32
+	Buckets [CountBuckets]bitmap.Bitmap
+}
+
+func CountBucket(cnt uint32) int {
+	if cnt < 16 {
+		return int(cnt)
+	}
+	return 16 + bits.Len32(cnt) - 5
+}
+
+// BucketBounds returns minimal and maximal counts of bucket.
+func BucketBounds(b int) (uint32, uint32) {
+	if b < 16 {
+		return uint32(b), uint32(b)
+	}
+	lo := uint32(1) << uint(b-12)
+	return lo, lo*2 - 1
+}
+
+func (ci *CountIndex) Get(uid int32) uint32 {
+	if uid < 0 || int(uid) >= len(ci.Counts) {
+		return 0
+	}
+	return ci.Counts[uid]
+}
+
+// Sure registers account in its bucket, even if its counter is zero.
+func (ci *CountIndex) Sure(uid int32) {
+	ci.Buckets[CountBucket(ci.Counts[uid])].Set(uid)
+}
+
+// Set sets counter and registers account in its bucket.
+func (ci *CountIndex) Set(uid int32, cnt uint32) {
+	ci.Buckets[CountBucket(ci.Counts[uid])].Unset(uid)
+	ci.Counts[uid] = cnt
+	ci.Buckets[CountBucket(cnt)].Set(uid)
+}
+
+func (ci *CountIndex) Add(uid int32, delta uint32) {
+	old := ci.Counts[uid]
+	ci.Counts[uid] += delta
+	ob, nb := CountBucket(old), CountBucket(old+delta)
+	if ob != nb {
+		ci.Buckets[ob].Unset(uid)
+		ci.Buckets[nb].Set(uid)
+	}
+}
+
+// Range returns accounts with lo <= count <= hi, or nil if there is none.
+// Matched members of edge buckets are collected into bitmap got from edges.
+func (ci *CountIndex) Range(lo, hi uint32, edges func() *bitmap.Bitmap) bitmap.IBitmap {
+	if lo > hi {
+		return nil
+	}
+	var maps []bitmap.IBitmap
+	var edge *bitmap.Bitmap
+	for b, bh := CountBucket(lo), CountBucket(hi); b <= bh; b++ {
+		mp := &ci.Buckets[b]
+		if mp.Count() == 0 {
+			continue
+		}
+		if start, end := BucketBounds(b); lo <= start && end <= hi {
+			maps = append(maps, mp)
+			continue
+		}
+		bitmap.Loop(mp, func(uids []int32) bool {
+			for _, uid := range uids {
+				if cnt := ci.Get(uid); cnt < lo || cnt > hi {
+					continue
+				}
+				if edge == nil {
+					edge = edges()
+				}
+				edge.Set(uid)
+			}
+			return true
+		})
+	}
+	if edge != nil {
+		maps = append(maps, edge)
+	}
+	switch len(maps) {
+	case 0:
+		return nil
+	case 1:
+		return maps[0]
+	}
+	return bitmap.NewOrBitmap(maps)
+}
+
+// LikesCount counts all likes received by account, LikersCount counts
+// distinct accounts liked it, LikedCount counts distinct accounts liked by
+// it.
+var LikesCount CountIndex
+var LikersCount CountIndex
+var LikedCount CountIndex
+
+// InterestsCount counts interests of account.
+var InterestsCount CountIndex
+
+// CountIndexes maps count predicate field to its index.
+var CountIndexes = map[string]*CountIndex{
+	"interests_count": &InterestsCount,
+	"likes_count":     &LikedCount,
+	"likers_count":    &LikersCount,
+}
+
+// AddLike stores like and updates popularity counters.
+func AddLike(likee, liker, ts int32) {
+	var first bool
+	SureLikers(likee, func(l *bitmap.Likes) { first = l.SetTs(likee, liker, ts) })
+	LikesCount.Add(likee, 1)
+	if first {
+		LikersCount.Add(likee, 1)
+		LikedCount.Add(liker, 1)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountBucket(t *testing.T) {
+	require.Equal(t, CountBuckets-1, CountBucket(^uint32(0)))
+	for b := 0; b < CountBuckets; b++ {
+		lo, hi := BucketBounds(b)
+		require.True(t, lo <= hi, "bucket %d", b)
+		require.Equal(t, b, CountBucket(lo), "bucket %d", b)
+		require.Equal(t, b, CountBucket(hi), "bucket %d", b)
+		if b+1 < CountBuckets {
+			nlo, _ := BucketBounds(b + 1)
+			require.Equal(t, hi+1, nlo, "buckets %d and %d are not adjacent", b, b+1)
+		} else {
+			require.Equal(t, ^uint32(0), hi)
+		}
+	}
+	for cnt := uint32(0); cnt < 100000; cnt++ {
+		lo, hi := BucketBounds(CountBucket(cnt))
+		require.True(t, lo <= cnt && cnt <= hi, "count %d", cnt)
+	}
+}
+
+func TestCountIndex(t *testing.T) {
+	ci := new(CountIndex)
+	counts := map[int32]uint32{}
+	check := func() {
+		for uid, cnt := range counts {
+			require.Equal(t, cnt, ci.Get(uid), "uid %d", uid)
+			for b := range ci.Buckets {
+				require.Equal(t, b == CountBucket(cnt), ci.Buckets[b].Has(uid), "uid %d bucket %d", uid, b)
+			}
+		}
+	}
+
+	for uid := int32(1); uid <= 50; uid++ {
+		ci.Sure(uid)
+		counts[uid] = 0
+	}
+	check()
+	for i := 0; i < 2000; i++ {
+		uid := int32(1 + i*7%50)
+		delta := uint32(1 + i%3)
+		ci.Add(uid, delta)
+		counts[uid] += delta
+	}
+	check()
+	ci.Add(3, 1<<20)
+	counts[3] += 1 << 20
+	check()
+
+	require.Zero(t, ci.Get(-1))
+	require.Zero(t, ci.Get(1<<30))
+}
+
+func TestCountIndexRange(t *testing.T) {
+	ci := new(CountIndex)
+	counts := map[int32]uint32{}
+	for uid := int32(1); uid <= 300; uid++ {
+		cnt := uint32(uid % 40)
+		if uid%7 == 0 {
+			cnt = uint32(uid) * 1000
+		}
+		ci.Sure(uid)
+		ci.Set(uid, cnt)
+		counts[uid] = cnt
+	}
+	// resetting moves account between buckets
+	ci.Set(5, 1<<20)
+	counts[5] = 1 << 20
+	ci.Set(14, 0)
+	counts[14] = 0
+
+	edges := func() *bitmap.Bitmap { return &bitmap.Bitmap{} }
+	bounds := []uint32{7000, 1<<20 - 1, 1 << 20, ^uint32(0)}
+	for cnt := uint32(0); cnt < 70; cnt++ {
+		bounds = append(bounds, cnt)
+	}
+	for _, lo := range bounds {
+		for _, hi := range bounds {
+			want := []int32{}
+			for uid := int32(300); uid > 0; uid-- {
+				if counts[uid] >= lo && counts[uid] <= hi {
+					want = append(want, uid)
+				}
+			}
+			got := []int32{}
+			if mp := ci.Range(lo, hi, edges); mp != nil {
+				bitmap.Loop(mp, func(uids []int32) bool {
+					got = append(got, uids...)
+					return true
+				})
+			}
+			require.Equal(t, want, got, "%d..%d", lo, hi)
+		}
+	}
+}
+
+// likersOf returns distinct accounts liked uid.
+func likersOf(uid int32) map[int32]bool {
+	res := map[int32]bool{}
+	if likers := GetLikers(uid); likers != nil {
+		for _, el := range likers.Data[:likers.Size] {
+			res[el.Uid] = true
+		}
+	}
+	return res
+}
+
+func TestCountFilter(t *testing.T) {
+	loadFixture(t)
+
+	fields := []struct {
+		name  string
+		count func(uid int32) int
+	}{
+		{"interests_count", func(uid int32) int { return len(accInterestSet(uid)) }},
+		{"likes_count", func(uid int32) int { return len(likesOf(uid)) }},
+		{"likers_count", func(uid int32) int { return len(likersOf(uid)) }},
+	}
+	check := func() {
+		for _, f := range fields {
+			for _, n := range []int{0, 1, 2, 3, 4, 5, 15, 16, 17, 31, 32} {
+				n := n
+				for _, c := range []struct {
+					op    string
+					match func(cnt int) bool
+				}{
+					{"gt", func(cnt int) bool { return cnt > n }},
+					{"lt", func(cnt int) bool { return cnt < n }},
+				} {
+					for _, limit := range []int{1, 20} {
+						want := bruteIds(limit, func(acc *Account) bool { return c.match(f.count(acc.Uid)) })
+						args := fmt.Sprintf("%s_%s=%d&limit=%d", f.name, c.op, n, limit)
+						require.Equal(t, want, filterIds(t, args), args)
+					}
+				}
+				// counts n and n+1 with other predicate
+				want := bruteIds(20, func(acc *Account) bool {
+					cnt := f.count(acc.Uid)
+					return !acc.Sex && cnt >= n && cnt <= n+1
+				})
+				args := fmt.Sprintf("%s_gt=%d&%s_lt=%d&sex_eq=f&limit=20", f.name, n-1, f.name, n+2)
+				if n == 0 {
+					args = fmt.Sprintf("%s_lt=2&sex_eq=f&limit=20", f.name)
+				}
+				require.Equal(t, want, filterIds(t, args), args)
+			}
+			require.Empty(t, filterIds(t, f.name+"_gt=4294967295&limit=5"))
+		}
+	}
+	check()
+
+	// interests replaced and likes repeated, so only distinct likes count
+	code, body := serve(t, "POST", "/accounts/5994/", `{"interests":["кино","рок","джаз","бег","йога","танцы"]}`)
+	require.Equal(t, 202, code, body)
+	require.Equal(t, 6, fields[0].count(5994))
+	for i := 0; i < 3; i++ {
+		for _, likee := range []int32{5993, 5995} {
+			body := fmt.Sprintf(`{"likes":[{"likee":%d,"liker":5994,"ts":%d}]}`, likee, 1530000000+i)
+			code, resp := serve(t, "POST", "/accounts/likes/", body)
+			require.Equal(t, 202, code, resp)
+		}
+	}
+	check()
+
+	for _, args := range []string{"interests_count_gt=-1", "likes_count_lt=abc", "likers_count_gt=4294967296", "likes_count_between=1,2", "likers_count_eq=1"} {
+		code, _ := serve(t, "GET", "/accounts/filter/?"+args+"&limit=5", "")
+		require.Equal(t, 400, code, args)
+	}
+}
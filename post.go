@@ -104,6 +104,11 @@ func doNew(ctx *Request) bool {
 	}
 
 	globMutex.Lock()
+	if !InterestsFit(accin.Interests) {
+		globMutex.Unlock()
+		logf("no room for new interests %v", accin.Interests)
+		return false
+	}
 	InsertAccount(&accin)
 	globMutex.Unlock()
 	ctx.SetStatusCode(201)
@@ -178,8 +183,9 @@ func doLikes(ctx *Request) bool {
 	globMutex.Lock()
 	for _, like := range likes {
 		bitmap.GetSmall(&HasAccount(like.Liker).Likes).Set(like.Likee)
-		SureLikers(like.Likee, func(l *bitmap.Likes) { l.SetTs(like.Likee, like.Liker, like.Ts) })
+		AddLike(like.Likee, like.Liker, like.Ts)
 	}
+	BumpCacheGen()
 	globMutex.Unlock()
 
 	logf("doLikes Looks to be ok")
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// RangeIndex buckets accounts by timestamp into bitmaps of 1<<Shift seconds
+// width. Range predicate ORs buckets covered completely and checks values
+// only in two edge buckets.
+// It is modified under globMutex (or by loader).
+type RangeIndex struct {
+	Shift   uint
+	Value   func(acc *Account) int32
+	Buckets []*bitmap.Bitmap
+}
+
+func (ri *RangeIndex) bucket(v int32) int {
+	return int((uint32(v) ^ 1<<31) >> ri.Shift)
+}
+
+// bounds returns minimal and maximal timestamps of bucket.
+func (ri *RangeIndex) bounds(b int) (int32, int32) {
+	lo := int64(b)<<ri.Shift + math.MinInt32
+	return int32(lo), int32(lo + 1<<ri.Shift - 1)
+}
+
+func (ri *RangeIndex) Set(uid int32, v int32) {
+	if ri.Buckets == nil {
+		ri.Buckets = make([]*bitmap.Bitmap, 1<<(32-ri.Shift))
+	}
+	b := ri.bucket(v)
+	if ri.Buckets[b] == nil {
+		ri.Buckets[b] = &bitmap.Bitmap{}
+	}
+	ri.Buckets[b].Set(uid)
+}
+
+func (ri *RangeIndex) Unset(uid int32, v int32) {
+	if ri.Buckets == nil {
+		return
+	}
+	if mp := ri.Buckets[ri.bucket(v)]; mp != nil {
+		mp.Unset(uid)
+	}
+}
+
+// Range returns accounts with lo <= value <= hi, or nil if there is none.
+// Matched members of edge buckets are collected into bitmap got from edges.
+func (ri *RangeIndex) Range(lo, hi int32, edges func() *bitmap.Bitmap) bitmap.IBitmap {
+	if ri.Buckets == nil || lo > hi {
+		return nil
+	}
+	var maps []bitmap.IBitmap
+	var edge *bitmap.Bitmap
+	for b, bh := ri.bucket(lo), ri.bucket(hi); b <= bh; b++ {
+		mp := ri.Buckets[b]
+		if mp == nil || mp.Count() == 0 {
+			continue
+		}
+		if start, end := ri.bounds(b); lo <= start && end <= hi {
+			maps = append(maps, mp)
+			continue
+		}
+		bitmap.Loop(mp, func(uids []int32) bool {
+			for _, uid := range uids {
+				if v := ri.Value(RefAccount(uid)); v < lo || v > hi {
+					continue
+				}
+				if edge == nil {
+					edge = edges()
+				}
+				edge.Set(uid)
+			}
+			return true
+		})
+	}
+	if edge != nil {
+		maps = append(maps, edge)
+	}
+	switch len(maps) {
+	case 0:
+		return nil
+	case 1:
+		return maps[0]
+	}
+	return bitmap.NewOrBitmap(maps)
+}
+
+// RangeIndexes maps predicate field to its index.
+var RangeIndexes = map[string]*RangeIndex{
+	"birth":          &BirthRange,
+	"joined":         &JoinedRange,
+	"premium_start":  &PremiumStartRange,
+	"premium_finish": &PremiumFinishRange,
+}
+
+// addRangeArg applies <field>_gt, <field>_lt (exclusive) and
+// <field>_between=from,to (inclusive) predicates over RangeIndexes, and also
+// age and count predicates. It returns false for unknown key.
+func (q *filterQuery) addRangeArg(skey, sval string) bool {
+	if q.addAgeArg(skey, sval) || q.addCountArg(skey, sval) {
+		return true
+	}
+	ix := strings.LastIndexByte(skey, '_')
+	if ix < 0 {
+		return false
+	}
+	field, op := skey[:ix], skey[ix+1:]
+	ri := RangeIndexes[field]
+	if ri == nil {
+		return false
+	}
+	parse := func(s string) int32 {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			logf("%s incorrect", skey)
+			q.correct = false
+		}
+		return int32(n)
+	}
+	lo, hi := int32(math.MinInt32), int32(math.MaxInt32)
+	switch op {
+	case "gt":
+		n := parse(sval)
+		if n == math.MaxInt32 {
+			q.emptyRes = true
+		}
+		lo = n + 1
+	case "lt":
+		n := parse(sval)
+		if n == math.MinInt32 {
+			q.emptyRes = true
+		}
+		hi = n - 1
+	case "between":
+		comma := strings.IndexByte(sval, ',')
+		if comma < 0 {
+			logf("%s incorrect", skey)
+			q.correct = false
+			return true
+		}
+		lo, hi = parse(sval[:comma]), parse(sval[comma+1:])
+	default:
+		return false
+	}
+	switch field {
+	case "birth":
+		q.outFields.Birth = true
+	case "joined":
+		q.outFields.Joined = true
+	default:
+		q.outFields.Premium = true
+	}
+	if q.correct && !q.emptyRes {
+		q.addRange(ri, lo, hi)
+	}
+	return true
+}
+
+// addRange adds accounts with lo <= value <= hi.
+func (q *filterQuery) addRange(ri *RangeIndex, lo, hi int32) {
+	mp := ri.Range(lo, hi, q.pooledMap)
+	if mp == nil {
+		q.emptyRes = true
+		return
+	}
+	q.maps = append(q.maps, mp)
+}
+
+// addCountArg applies <field>_gt and <field>_lt predicates over
+// CountIndexes. It returns false for unknown key.
+func (q *filterQuery) addCountArg(skey, sval string) bool {
+	ix := strings.LastIndexByte(skey, '_')
+	if ix < 0 {
+		return false
+	}
+	ci := CountIndexes[skey[:ix]]
+	if ci == nil {
+		return false
+	}
+	op := skey[ix+1:]
+	if op != "gt" && op != "lt" {
+		return false
+	}
+	n, err := strconv.ParseUint(sval, 10, 32)
+	if err != nil {
+		logf("%s incorrect", skey)
+		q.correct = false
+		return true
+	}
+	lo, hi := uint32(0), uint32(math.MaxUint32)
+	if op == "gt" {
+		if n == math.MaxUint32 {
+			q.emptyRes = true
+			return true
+		}
+		lo = uint32(n) + 1
+	} else {
+		if n == 0 {
+			q.emptyRes = true
+			return true
+		}
+		hi = uint32(n) - 1
+	}
+	mp := ci.Range(lo, hi, q.pooledMap)
+	if mp == nil {
+		q.emptyRes = true
+		return true
+	}
+	q.maps = append(q.maps, mp)
+	return true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeIndexBuckets(t *testing.T) {
+	for _, shift := range []uint{21, 22, 25} {
+		ri := &RangeIndex{Shift: shift}
+		last := 1<<(32-shift) - 1
+		require.Equal(t, 0, ri.bucket(math.MinInt32))
+		require.Equal(t, last, ri.bucket(math.MaxInt32))
+		for _, b := range []int{0, 1, last / 2, last/2 + 1, last - 1, last} {
+			lo, hi := ri.bounds(b)
+			require.Equal(t, int64(1)<<shift-1, int64(hi)-int64(lo), "shift %d bucket %d", shift, b)
+			require.Equal(t, b, ri.bucket(lo), "shift %d bucket %d", shift, b)
+			require.Equal(t, b, ri.bucket(hi), "shift %d bucket %d", shift, b)
+			if b < last {
+				require.Equal(t, b+1, ri.bucket(hi+1), "shift %d bucket %d", shift, b)
+			}
+		}
+	}
+	// buckets are ordered as signed values
+	ri := &RangeIndex{Shift: 25}
+	require.True(t, ri.bucket(-1) < ri.bucket(0))
+	require.True(t, ri.bucket(-1<<25-1) < ri.bucket(-1))
+}
+
+type rangeField struct {
+	name  string
+	index *RangeIndex
+	value func(acc *Account) int32
+	has   func(acc *Account) bool
+}
+
+// rangePivots returns values around which predicates are checked: values of
+// some accounts, their neighbours and bounds of buckets they fall into.
+func rangePivots(f rangeField) []int32 {
+	var pivots []int32
+	n := 0
+	for uid := int32(1); uid <= fixtureSize && n < 4; uid += 37 {
+		acc := RefAccount(uid)
+		if !f.has(acc) {
+			continue
+		}
+		n++
+		v := f.value(acc)
+		lo, hi := f.index.bounds(f.index.bucket(v))
+		pivots = append(pivots, v-1, v, v+1, lo-1, lo, hi, hi+1)
+	}
+	return pivots
+}
+
+func TestRangeFilter(t *testing.T) {
+	loadFixture(t)
+
+	// fixture has no premium, so give it to some accounts
+	lengths := []int32{30, 91, 182, 365}
+	for uid := int32(9); uid <= fixtureSize; uid += 9 {
+		start := unix2018 + uid*3001
+		finish := start + lengths[uid%4]*24*3600
+		body := fmt.Sprintf(`{"premium":{"start":%d,"finish":%d}}`, start, finish)
+		code, resp := serve(t, "POST", fmt.Sprintf("/accounts/%d/", uid), body)
+		require.Equal(t, 202, code, resp)
+	}
+
+	premium := func(acc *Account) bool { return PremiumNotNull.Has(acc.Uid) }
+	all := func(*Account) bool { return true }
+	fields := []rangeField{
+		{"birth", &BirthRange, func(acc *Account) int32 { return acc.Birth }, all},
+		{"joined", &JoinedRange, func(acc *Account) int32 { return acc.Joined }, all},
+		{"premium_start", &PremiumStartRange, func(acc *Account) int32 { return acc.PremiumStart }, premium},
+		{"premium_finish", &PremiumFinishRange, (*Account).PremiumFinish, premium},
+	}
+	check := func(f rangeField, args string, match func(v int32) bool) {
+		for _, limit := range []int{1, 20} {
+			want := bruteIds(limit, func(acc *Account) bool { return f.has(acc) && match(f.value(acc)) })
+			q := fmt.Sprintf("%s&limit=%d", args, limit)
+			require.Equal(t, want, filterIds(t, q), q)
+		}
+		want := bruteIds(20, func(acc *Account) bool { return !acc.Sex && f.has(acc) && match(f.value(acc)) })
+		require.Equal(t, want, filterIds(t, args+"&sex_eq=f&limit=20"), args)
+	}
+	checkAll := func(f rangeField) {
+		pivots := rangePivots(f)
+		require.NotEmpty(t, pivots, f.name)
+		pivots = append(pivots, math.MinInt32, math.MaxInt32)
+		for _, p := range pivots {
+			p := p
+			check(f, fmt.Sprintf("%s_gt=%d", f.name, p), func(v int32) bool { return v > p })
+			check(f, fmt.Sprintf("%s_lt=%d", f.name, p), func(v int32) bool { return v < p })
+		}
+		for i := 0; i+1 < len(pivots); i++ {
+			lo, hi := pivots[i], pivots[i+1]
+			check(f, fmt.Sprintf("%s_between=%d,%d", f.name, lo, hi), func(v int32) bool { return v >= lo && v <= hi })
+		}
+	}
+	for _, f := range fields {
+		checkAll(f)
+	}
+
+	// moved values leave their old buckets and land exactly on the bounds of
+	// previous one, so whole bucket is taken only when both bounds are in
+	// range; update validates joined together with birth, so it is passed
+	// unchanged
+	setBirth := func(uid, birth int32) {
+		body := fmt.Sprintf(`{"birth":%d,"joined":%d}`, birth, RefAccount(uid).Joined)
+		code, resp := serve(t, "POST", fmt.Sprintf("/accounts/%d/", uid), body)
+		require.Equal(t, 202, code, resp)
+	}
+	old := map[int32]int32{5998: RefAccount(5998).Birth, 5996: RefAccount(5996).Birth}
+	lo, hi := BirthRange.bounds(BirthRange.bucket(old[5998]) - 1)
+	setBirth(5998, hi)
+	setBirth(5996, lo)
+	require.Contains(t, filterIds(t, fmt.Sprintf("birth_between=%d,%d&limit=50", hi, hi)), int32(5998))
+	require.NotContains(t, filterIds(t, fmt.Sprintf("birth_between=%d,%d&limit=50", old[5998], old[5998])), int32(5998))
+	checkAll(fields[0])
+	for _, p := range []int32{lo - 1, lo, lo + 1, hi - 1, hi, hi + 1} {
+		p := p
+		check(fields[0], fmt.Sprintf("birth_gt=%d", p), func(v int32) bool { return v > p })
+		check(fields[0], fmt.Sprintf("birth_lt=%d", p), func(v int32) bool { return v < p })
+	}
+	for _, r := range [][2]int32{{lo, hi}, {lo + 1, hi}, {lo, hi - 1}, {lo - 1, hi + 1}} {
+		r := r
+		check(fields[0], fmt.Sprintf("birth_between=%d,%d", r[0], r[1]), func(v int32) bool { return v >= r[0] && v <= r[1] })
+	}
+	for uid, birth := range old {
+		setBirth(uid, birth)
+	}
+	checkAll(fields[0])
+
+	for _, args := range []string{"birth_gt=abc", "joined_lt=", "premium_start_between=1", "premium_finish_between=1,x", "birth_ge=1", "birth_gt=99999999999"} {
+		code, _ := serve(t, "GET", "/accounts/filter/?"+args+"&limit=5", "")
+		require.Equal(t, 400, code, args)
+	}
+}
@@ -5,16 +5,22 @@ type Recommends struct {
 	Limit     int
 	Birth     int32
 	Heapified bool
+	Me        *Account
+	Scorer    RecScorer
 }
 
 type RecElem struct {
 	SmallAccount
 	Uid     int32
 	Commons uint32
+	Score   int64
 }
 
 func (r *Recommends) Add(acc SmallAccount, uid int32, common uint32) {
-	el := RecElem{acc, uid, common}
+	el := RecElem{SmallAccount: acc, Uid: uid, Commons: common}
+	if r.Scorer != nil {
+		el.Score = r.Scorer.Score(r.Me, &el)
+	}
 	if len(r.Accs) < r.Limit {
 		r.Accs = append(r.Accs, el)
 		if len(r.Accs) == r.Limit {
@@ -45,6 +51,12 @@ var recStatus = func() [4]uint8 {
 }()
 
 func (r *Recommends) LessAcc(acci, accj RecElem) bool {
+	if r.Scorer != nil {
+		if acci.Score != accj.Score {
+			return acci.Score < accj.Score
+		}
+		return acci.Uid > accj.Uid
+	}
 	if acci.Premium() != accj.Premium() {
 		return accj.Premium()
 	}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecommendFilters(t *testing.T) {
+	loadFixture(t)
+
+	type filterCase struct {
+		args  string
+		match func(me, acc *Account) bool
+	}
+	hasInterests := func(names ...string) func(me, acc *Account) bool {
+		return func(_, acc *Account) bool {
+			set := accInterestSet(acc.Uid)
+			for _, name := range names {
+				if !set[int32(InterestStrings.Find(name))] {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	const birth = 650000000
+	cases := []filterCase{
+		{"birth_gt=650000000", func(_, acc *Account) bool { return acc.Birth > birth }},
+		{"birth_lt=650000000", func(_, acc *Account) bool { return acc.Birth < birth }},
+		{"birth_gt=500000000&birth_lt=700000000", func(_, acc *Account) bool {
+			return acc.Birth > 500000000 && acc.Birth < 700000000
+		}},
+		{"birth_gt=2000000000", func(_, acc *Account) bool { return acc.Birth > 2000000000 }},
+		{"birth_lt=-1000000000", func(_, acc *Account) bool { return acc.Birth < -1000000000 }},
+		{"status_eq=" + StatusFree, func(_, acc *Account) bool { return acc.Status == StatusFreeIx }},
+		{"status_eq=" + StatusMeeting, func(_, acc *Account) bool { return acc.Status == StatusMeetingIx }},
+		{"status_eq=" + StatusComplex, func(_, acc *Account) bool { return acc.Status == StatusComplexIx }},
+		{"premium_now=1", func(_, acc *Account) bool { return acc.PremiumNow }},
+		{"premium_now=0", func(_, acc *Account) bool { return true }},
+		{"interests_contains=кино", hasInterests("кино")},
+		{"interests_contains=спорт,музыка", hasInterests("спорт", "музыка")},
+		{"exclude_liked=1", func(me, acc *Account) bool {
+			return !bitmap.GetSmall(&me.Likes).Has(acc.Uid)
+		}},
+		{"exclude_liked=0", func(_, acc *Account) bool { return true }},
+		{"status_eq=" + StatusFree + "&premium_now=1&exclude_liked=1", func(me, acc *Account) bool {
+			return acc.Status == StatusFreeIx && acc.PremiumNow &&
+				!bitmap.GetSmall(&me.Likes).Has(acc.Uid)
+		}},
+	}
+
+	checked, liked := 0, 0
+	for id := int32(3); id <= fixtureSize && checked < 30; id += 41 {
+		me := HasAccount(id)
+		if me == nil || len(accInterestSet(id)) == 0 {
+			continue
+		}
+		checked++
+		cands := bruteCandidates(me)
+		sort.Slice(cands, func(i, j int) bool { return recClassicLess(cands[i], cands[j]) })
+		for _, c := range cands {
+			if bitmap.GetSmall(&me.Likes).Has(c.uid) {
+				liked++
+			}
+		}
+		for _, tc := range cases {
+			want := []int32{}
+			for _, c := range cands {
+				if len(want) == 10 {
+					break
+				}
+				if tc.match(me, RefAccount(c.uid)) {
+					want = append(want, c.uid)
+				}
+			}
+			args := escapeArgs(tc.args) + "&limit=10"
+			got := recommendIds(t, id, args)
+			require.Equal(t, want, got, "id %d %s", id, tc.args)
+		}
+	}
+	require.NotZero(t, checked)
+	require.NotZero(t, liked, "exclude_liked is not exercised")
+}
+
+func TestRecommendFiltersIncorrect(t *testing.T) {
+	loadFixture(t)
+	for _, args := range []string{
+		"birth_gt=abc",
+		"birth_lt=",
+		"status_eq=unknown",
+		"premium_now=2",
+		"interests_contains=",
+		"exclude_liked=yes",
+	} {
+		uri := fmt.Sprintf("/accounts/1/recommend/?%s&limit=5", escapeArgs(args))
+		code, _ := serve(t, "GET", uri, "")
+		require.Equal(t, 400, code, args)
+	}
+	require.Empty(t, recommendIds(t, 1, escapeArgs("interests_contains=кино,неизвестное")+"&limit=5"))
+}
+
+// escapeArgs escapes values of raw query string.
+func escapeArgs(args string) string {
+	parts := strings.Split(args, "&")
+	for i, part := range parts {
+		if ix := strings.IndexByte(part, '='); ix != -1 {
+			parts[i] = part[:ix+1] + url.QueryEscape(part[ix+1:])
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+type scoredRecommend struct {
+	Id              int32    `json:"id"`
+	Commons         uint32   `json:"commons"`
+	BirthDelta      uint32   `json:"birth_delta"`
+	Score           *int64   `json:"score"`
+	SharedInterests []string `json:"shared_interests"`
+}
+
+func TestRecommendWithScore(t *testing.T) {
+	loadFixture(t)
+
+	checked := 0
+	for id := int32(11); id <= fixtureSize && checked < 20; id += 43 {
+		me := HasAccount(id)
+		if me == nil || len(accInterestSet(id)) == 0 {
+			continue
+		}
+		checked++
+		cands := map[int32]recCandidate{}
+		for _, c := range bruteCandidates(me) {
+			cands[c.uid] = c
+		}
+		for _, scoring := range []string{ScoringClassic, ScoringWeighted, ScoringInterests, ScoringReciprocal} {
+			args := "limit=10&scoring=" + scoring
+			plain := recommendIds(t, id, args)
+
+			uri := fmt.Sprintf("/accounts/%d/recommend/?%s&with_score=1", id, args)
+			code, body := serve(t, "GET", uri, "")
+			require.Equal(t, 200, code, "%s: %s", uri, body)
+			var res struct {
+				Accounts []scoredRecommend `json:"accounts"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+
+			require.Len(t, res.Accounts, len(plain), uri)
+			for i, acc := range res.Accounts {
+				require.Equal(t, plain[i], acc.Id, "with_score changes order: %s", uri)
+				c := cands[acc.Id]
+				require.Equal(t, uint32(c.commons), acc.Commons, uri)
+				require.Equal(t, uint32(c.distance), acc.BirthDelta, uri)
+
+				var shared []string
+				other := accInterestSet(acc.Id)
+				for ix := range accInterestSet(id) {
+					if other[ix] {
+						shared = append(shared, InterestStrings.GetStr(uint32(ix)))
+					}
+				}
+				require.ElementsMatch(t, shared, acc.SharedInterests, uri)
+
+				if scoring == ScoringClassic {
+					require.Nil(t, acc.Score, uri)
+					continue
+				}
+				require.NotNil(t, acc.Score, uri)
+				if i > 0 {
+					require.True(t, *res.Accounts[i-1].Score >= *acc.Score, "scores are not ordered: %s", uri)
+				}
+				switch scoring {
+				case ScoringWeighted:
+					require.Equal(t, weightedScore(c), *acc.Score, uri)
+				case ScoringInterests:
+					require.Equal(t, int64(c.commons)<<32-c.distance, *acc.Score, uri)
+				}
+			}
+		}
+	}
+	require.NotZero(t, checked)
+
+	code, _ := serve(t, "GET", "/accounts/1/recommend/?limit=5&with_score=yes", "")
+	require.Equal(t, 400, code)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+// RecScorer ranks recommendation candidates. Greater score is better,
+// ties are broken by smaller uid.
+// Classic scorer is nil: it is handled by Recommends.LessAcc directly,
+// since doRecommend may stop early thanks to its prefiltering order.
+type RecScorer interface {
+	Score(me *Account, el *RecElem) int64
+}
+
+const (
+	ScoringClassic    = "classic"
+	ScoringWeighted   = "weighted"
+	ScoringInterests  = "interests"
+	ScoringReciprocal = "reciprocal"
+)
+
+const yearSeconds = 365*24*3600 + 6*3600
+
+func GetRecScorer(name string) (RecScorer, bool) {
+	switch name {
+	case ScoringClassic:
+		return nil, true
+	case ScoringWeighted:
+		return &DefaultWeights, true
+	case ScoringInterests:
+		return interestsScorer{}, true
+	case ScoringReciprocal:
+		return reciprocalScorer{}, true
+	}
+	return nil, false
+}
+
+// WeightedScorer sums weighted features of candidate.
+type WeightedScorer struct {
+	Premium      int64
+	Status       int64 // per recStatus step
+	Common       int64 // per shared interest
+	SameCity     int64
+	JoinedYear   int64 // per year of joined after 2011
+	Reciprocal   int64 // candidate likes me
+	YearDistance int64 // penalty per year of birth distance
+}
+
+var DefaultWeights = WeightedScorer{
+	Premium:      200,
+	Status:       100,
+	Common:       50,
+	SameCity:     80,
+	JoinedYear:   5,
+	Reciprocal:   150,
+	YearDistance: 10,
+}
+
+func (w *WeightedScorer) Score(me *Account, el *RecElem) int64 {
+	var score int64
+	if el.Premium() {
+		score += w.Premium
+	}
+	score += w.Status * int64(recStatus[el.Status()])
+	score += w.Common * int64(el.Commons)
+	if me.City != 0 && el.City == me.City {
+		score += w.SameCity
+	}
+	other := RefAccount(el.Uid)
+	score += w.JoinedYear * int64(GetJoinYear(other.Joined))
+	if bitmap.GetSmall(&other.Likes).Has(me.Uid) {
+		score += w.Reciprocal
+	}
+	score -= w.YearDistance * int64(birthDistance(me.Birth, el.Birth)/yearSeconds)
+	return score
+}
+
+// interestsScorer prefers shared interests above all, then closer age.
+type interestsScorer struct{}
+
+func (interestsScorer) Score(me *Account, el *RecElem) int64 {
+	return int64(el.Commons)<<32 - int64(birthDistance(me.Birth, el.Birth))
+}
+
+// reciprocalScorer puts candidates who already like me first, then
+// ranks by classic order.
+type reciprocalScorer struct{}
+
+func (reciprocalScorer) Score(me *Account, el *RecElem) int64 {
+	var score int64
+	if bitmap.GetSmall(&RefAccount(el.Uid).Likes).Has(me.Uid) {
+		score = 1
+	}
+	score = score<<1 | int64(boolInt(el.Premium()))
+	score = score<<2 | int64(recStatus[el.Status()])
+	score = score<<8 | int64(el.Commons)
+	return score<<32 - int64(birthDistance(me.Birth, el.Birth))
+}
+
+func birthDistance(a, b int32) uint32 {
+	if a > b {
+		return uint32(a - b)
+	}
+	return uint32(b - a)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
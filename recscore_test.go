@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+	"github.com/stretchr/testify/require"
+)
+
+// recommendIds returns ids of /accounts/<id>/recommend/ response.
+func recommendIds(t *testing.T, id int32, args string) []int32 {
+	uri := fmt.Sprintf("/accounts/%d/recommend/?%s", id, args)
+	code, body := serve(t, "GET", uri, "")
+	require.Equal(t, 200, code, "%s: %s", uri, body)
+	var res struct {
+		Accounts []filterAccount `json:"accounts"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+	ids := make([]int32, 0, len(res.Accounts))
+	for _, acc := range res.Accounts {
+		ids = append(ids, acc.Id)
+	}
+	return ids
+}
+
+// recCandidate holds features ranked by scorers, computed from account
+// fields without RecElem.
+type recCandidate struct {
+	uid      int32
+	premium  bool
+	status   int
+	commons  int
+	sameCity bool
+	joined   int32
+	likesMe  bool
+	distance int64
+}
+
+func recStatusRank(ix uint8) int {
+	switch ix {
+	case StatusFreeIx:
+		return 2
+	case StatusComplexIx:
+		return 1
+	}
+	return 0
+}
+
+// bruteCandidates returns every account of other sex sharing an interest with me.
+func bruteCandidates(me *Account) []recCandidate {
+	mine := accInterestSet(me.Uid)
+	var res []recCandidate
+	for uid := int32(1); uid < MaxId; uid++ {
+		acc := HasAccount(uid)
+		if acc == nil || acc.Sex == me.Sex {
+			continue
+		}
+		commons := 0
+		for ix := range accInterestSet(uid) {
+			if mine[ix] {
+				commons++
+			}
+		}
+		if commons == 0 {
+			continue
+		}
+		distance := int64(acc.Birth) - int64(me.Birth)
+		if distance < 0 {
+			distance = -distance
+		}
+		res = append(res, recCandidate{
+			uid:      uid,
+			premium:  acc.PremiumNow,
+			status:   recStatusRank(acc.Status),
+			commons:  commons,
+			sameCity: me.City != 0 && acc.City == me.City,
+			joined:   GetJoinYear(acc.Joined),
+			likesMe:  bitmap.GetSmall(&acc.Likes).Has(me.Uid),
+			distance: distance,
+		})
+	}
+	return res
+}
+
+func accInterestSet(uid int32) map[int32]bool {
+	res := map[int32]bool{}
+	GetInterest(uid).Unroll(func(ix int32) {
+		res[ix] = true
+	})
+	return res
+}
+
+// weightedScore is DefaultWeights score of candidate.
+func weightedScore(c recCandidate) int64 {
+	w := DefaultWeights
+	score := w.Premium*int64(boolRank(c.premium)) +
+		w.Status*int64(c.status) +
+		w.Common*int64(c.commons) +
+		w.SameCity*int64(boolRank(c.sameCity)) +
+		w.JoinedYear*int64(c.joined) +
+		w.Reciprocal*int64(boolRank(c.likesMe))
+	return score - w.YearDistance*(c.distance/yearSeconds)
+}
+
+// recClassicLess reports whether a ranks before b in classic order.
+func recClassicLess(a, b recCandidate) bool {
+	if a.premium != b.premium {
+		return a.premium
+	}
+	if a.status != b.status {
+		return a.status > b.status
+	}
+	if a.commons != b.commons {
+		return a.commons > b.commons
+	}
+	if a.distance != b.distance {
+		return a.distance < b.distance
+	}
+	return a.uid < b.uid
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestRecommendScoring(t *testing.T) {
+	loadFixture(t)
+
+	// less reports whether a ranks before b
+	strategies := map[string]func(a, b recCandidate) bool{
+		ScoringClassic: recClassicLess,
+		ScoringWeighted: func(a, b recCandidate) bool {
+			if sa, sb := weightedScore(a), weightedScore(b); sa != sb {
+				return sa > sb
+			}
+			return a.uid < b.uid
+		},
+		ScoringInterests: func(a, b recCandidate) bool {
+			if a.commons != b.commons {
+				return a.commons > b.commons
+			}
+			if a.distance != b.distance {
+				return a.distance < b.distance
+			}
+			return a.uid < b.uid
+		},
+		ScoringReciprocal: func(a, b recCandidate) bool {
+			if a.likesMe != b.likesMe {
+				return a.likesMe
+			}
+			if a.premium != b.premium {
+				return a.premium
+			}
+			if a.status != b.status {
+				return a.status > b.status
+			}
+			if a.commons != b.commons {
+				return a.commons > b.commons
+			}
+			if a.distance != b.distance {
+				return a.distance < b.distance
+			}
+			return a.uid < b.uid
+		},
+	}
+
+	checked := 0
+	for id := int32(1); id <= fixtureSize && checked < 40; id += 37 {
+		me := HasAccount(id)
+		if me == nil || len(accInterestSet(id)) == 0 {
+			continue
+		}
+		checked++
+		cands := bruteCandidates(me)
+		for name, less := range strategies {
+			sort.Slice(cands, func(i, j int) bool { return less(cands[i], cands[j]) })
+			for _, limit := range []int{1, 7, 20} {
+				want := []int32{}
+				for _, c := range cands {
+					if len(want) == limit {
+						break
+					}
+					want = append(want, c.uid)
+				}
+				got := recommendIds(t, id, fmt.Sprintf("limit=%d&scoring=%s", limit, name))
+				require.Equal(t, want, got, "id %d scoring %s limit %d", id, name, limit)
+			}
+		}
+	}
+	require.NotZero(t, checked)
+}
+
+func TestRecommendScoringUnknown(t *testing.T) {
+	loadFixture(t)
+	code, _ := serve(t, "GET", "/accounts/1/recommend/?limit=5&scoring=random", "")
+	require.Equal(t, 400, code)
+	for _, name := range []string{ScoringClassic, ScoringWeighted, ScoringInterests, ScoringReciprocal} {
+		_, ok := GetRecScorer(name)
+		require.True(t, ok, name)
+	}
+	_, ok := GetRecScorer("random")
+	require.False(t, ok)
+}
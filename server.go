@@ -1,4 +1,6 @@
+//go:build linux
 // +build linux
+
 package main
 
 import (
@@ -7,41 +9,91 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"runtime"
 	"strconv"
 	"syscall"
 	"time"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 const epollQueue = 4000
 
-var epollfd int
-var readChan = make(chan File, 128)
+const (
+	EpollShared    = "shared"
+	EpollReusePort = "reuseport"
+)
 
 func Acceptor(port int) {
-	runtime.LockOSThread()
+	initConns()
 
-	var err error
-	epollfd, err = syscall.EpollCreate(10000)
+	nworkers, err := workerCount(*workers, *epollMode)
 	if err != nil {
 		log.Fatal(err)
 	}
-	//go Epoller()
+	fmt.Printf("numcpu %d workers %d epoll %s\n", runtime.NumCPU(), nworkers, *epollMode)
+
+	switch *epollMode {
+	case EpollShared:
+		runtime.LockOSThread()
+		epollfd := newEpoll()
+		for i := 0; i < nworkers; i++ {
+			go EpollHttp(i, epollfd, -1)
+		}
+		sock := listenSocket(port, false)
+		for {
+			connfd, _, err := syscall.Accept(sock)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+			addConn(epollfd, connfd)
+		}
+	case EpollReusePort:
+		// every worker has its own listener and epoll instance,
+		// so kernel balances connections between them.
+		for i := 1; i < nworkers; i++ {
+			go EpollHttp(i, newEpoll(), listenSocket(port, true))
+		}
+		EpollHttp(0, newEpoll(), listenSocket(port, true))
+	}
+}
+
+// workerCount checks epoll flags and returns number of workers to start,
+// 0 workers means by number of cpus.
+func workerCount(n int, mode string) (int, error) {
+	if mode != EpollShared && mode != EpollReusePort {
+		return 0, fmt.Errorf("unknown epoll mode %q", mode)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("workers count %d is negative", n)
+	}
+	if n > 0 {
+		return n, nil
+	}
 	ncpu := runtime.NumCPU()
-	fmt.Print("numcpu ", ncpu)
 	if ncpu < 4 {
 		ncpu = 4
 	} else if ncpu > 32 {
 		ncpu = 32
 	}
-	ncpu += 1 //ncpu / 4
-	for i := 0; i < ncpu; i++ {
-		go EpollHttp()
-		//go HTTPHandler()
+	return ncpu + 1, nil //ncpu / 4
+}
+
+func newEpoll() int {
+	epollfd, err := syscall.EpollCreate(10000)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return epollfd
+}
 
+func listenSocket(port int, reusePort bool) int {
 	sock, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
 	if err != nil {
 		log.Fatal(err)
@@ -50,6 +102,14 @@ func Acceptor(port int) {
 	if err = syscall.SetsockoptInt(sock, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
 		log.Fatal(err)
 	}
+	if reusePort {
+		if err = syscall.SetsockoptInt(sock, syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			log.Fatal(err)
+		}
+		if err = syscall.SetNonblock(sock, true); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	err = syscall.Bind(sock, &syscall.SockaddrInet4{Port: port})
 	if err != nil {
@@ -60,52 +120,64 @@ func Acceptor(port int) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	return sock
+}
+
+func addConn(epollfd int, connfd int) {
+	if err := syscall.SetsockoptInt(connfd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1); err != nil {
+		log.Fatal(err)
+	}
 
+	c := acceptConn(connfd)
+	if c == nil {
+		logf("connection limit reached")
+		return
+	}
+	if !c.arm(epollfd, File(connfd), true) {
+		c.close(File(connfd))
+	}
+}
+
+// acceptAll drains nonblocking listener of worker with own epoll.
+func acceptAll(epollfd int, sock int) {
 	for {
 		connfd, _, err := syscall.Accept(sock)
-		if err == syscall.EINTR {
-			continue
-		}
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if err = syscall.SetsockoptInt(connfd, syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 1); err != nil {
+		switch err {
+		case nil:
+			addConn(epollfd, connfd)
+		case syscall.EINTR:
+		case syscall.EAGAIN, syscall.ECONNABORTED:
+			return
+		default:
 			log.Fatal(err)
 		}
+	}
+}
 
-		File(connfd).addToEpoll(true)
+func pinThread(worker int) {
+	var set unix.CPUSet
+	set.Set(worker % runtime.NumCPU())
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		log.Printf("could not pin worker %d: %v", worker, err)
 	}
 }
 
-func Epoller() {
+// EpollHttp serves connections from epollfd. If listener is not -1,
+// it is watched by the same epoll and accepted connections are served
+// by this worker only.
+func EpollHttp(worker int, epollfd int, listener int) {
 	runtime.LockOSThread()
-	events := make([]syscall.EpollEvent, epollQueue)
-	for {
-		nevents, err := syscall.EpollWait(epollfd, events, -1)
-		if err != nil {
-			if err == syscall.EINTR {
-				continue
-			}
+	if *cpuPin {
+		pinThread(worker)
+	}
+	if listener != -1 {
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(listener)}
+		if err := syscall.EpollCtl(epollfd, syscall.EPOLL_CTL_ADD, listener, &ev); err != nil {
 			log.Fatal(err)
 		}
-		for _, event := range events[:nevents] {
-			switch {
-			case event.Events&(syscall.EPOLLHUP|syscall.EPOLLRDHUP) != 0:
-				syscall.Close(int(event.Fd))
-			case event.Events&syscall.EPOLLIN != 0:
-				readChan <- File(event.Fd)
-			default:
-				log.Fatalf("Unknown epoll event %x", event.Events)
-			}
-		}
 	}
-}
-
-func EpollHttp() {
-	runtime.LockOSThread()
 	var events [1]syscall.EpollEvent
-	var req Request
+	req := new(Request)
 	for {
 		nevents, err := syscall.EpollWait(epollfd, events[:], -1)
 		if err != nil {
@@ -116,42 +188,62 @@ func EpollHttp() {
 		}
 		if nevents == 1 {
 			event := events[0]
+			if int(event.Fd) == listener {
+				acceptAll(epollfd, listener)
+				continue
+			}
+			fd := File(event.Fd)
+			c := takeConn(int(fd), uint32(event.Pad))
+			if c == nil {
+				// connection were reaped meanwhile
+				continue
+			}
 			ok := false
 			switch {
 			case event.Events&(syscall.EPOLLHUP|syscall.EPOLLRDHUP) != 0:
 			case event.Events&syscall.EPOLLIN != 0:
-				ok = HTTPHandleFd(File(event.Fd), &req)
+				req, ok = serveConn(fd, c, req)
 			default:
 				log.Fatalf("Unknown epoll event %x", event.Events)
 			}
-			if !ok {
-				File(event.Fd).Close()
-			} else {
-				File(event.Fd).addToEpoll(false)
+			if !ok || !c.arm(epollfd, fd, false) {
+				c.close(fd)
 			}
 		}
 	}
 }
 
-func HTTPHandler() {
-	//runtime.LockOSThread()
-	var req Request
-	for fd := range readChan {
-		HTTPHandleFd(fd, &req)
+// serveConn continues request pending on connection or starts new one
+// using spare. Incomplete request is left in c.req until more data arrives,
+// and new spare is returned to the worker.
+func serveConn(fd File, c *conn, spare *Request) (*Request, bool) {
+	req := c.req
+	if req == nil {
+		req = spare
+		req.Reset(fd)
+		req.Start = time.Now().UnixNano()
+	}
+	c.req = nil
+	err := req.Parse()
+	if err == errAgain {
+		c.req = req
+		if req == spare {
+			spare = requestPool.Get().(*Request)
+		}
+		return spare, true
 	}
-}
-
-func HTTPHandleFd(fd File, req *Request) bool {
-	*req = Request{
-		File: fd,
-		Args: req.Args[:0],
+	if req != spare {
+		defer requestPool.Put(req)
 	}
-	err := req.Parse()
 	if err != nil {
-		log.Print(err)
-		return false
+		logf("parse: %v", err)
+		return spare, false
 	}
-	err = myHandler(req)
+	return spare, HTTPServeRequest(req)
+}
+
+func HTTPServeRequest(req *Request) bool {
+	err := myHandler(req)
 	if err != nil {
 		if !req.Written {
 			req.SetStatusCode(500)
@@ -169,17 +261,16 @@ func HTTPHandleFd(fd File, req *Request) bool {
 
 type File int
 
-func (f File) addToEpoll(add bool) {
+func (f File) addToEpoll(epollfd int, add bool, gen uint32) error {
 	var ev syscall.EpollEvent
 	ev.Events = syscall.EPOLLRDHUP | syscall.EPOLLONESHOT | syscall.EPOLLIN
 	ev.Fd = int32(f)
+	ev.Pad = int32(gen)
 	kind := syscall.EPOLL_CTL_MOD
 	if add {
 		kind = syscall.EPOLL_CTL_ADD
 	}
-	if err := syscall.EpollCtl(epollfd, kind, int(f), &ev); err != nil {
-		log.Fatal(err)
-	}
+	return syscall.EpollCtl(epollfd, kind, int(f), &ev)
 }
 
 func (f File) Read(b []byte) (n int, err error) {
@@ -196,6 +287,34 @@ repeat:
 	return
 }
 
+// ReadNonblock reads whatever is already received, and returns errAgain
+// if there is nothing.
+func (f File) ReadNonblock(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return 0, io.EOF
+	}
+repeat:
+	nn, _, serr := syscall.Syscall6(syscall.SYS_RECVFROM,
+		uintptr(f),
+		uintptr(unsafe.Pointer(&b[0])),
+		uintptr(len(b)),
+		syscall.MSG_DONTWAIT, 0, 0)
+	switch serr {
+	case 0:
+		n = int(nn)
+		if n == 0 {
+			err = io.EOF
+		}
+	case syscall.EINTR:
+		goto repeat
+	case syscall.EAGAIN:
+		err = errAgain
+	default:
+		err = serr
+	}
+	return
+}
+
 func (f File) Write(b []byte) (n int, err error) {
 	for n < len(b) {
 		var nn int
@@ -268,15 +387,25 @@ func (f File) Close() error {
 
 type Request struct {
 	File          File
+	Conn          net.Conn
 	BufBuf        [8192]byte
 	Filled        int
 	LastLine      int
 	ContentLength int
+	HeadDone      bool
+	Start         int64
 	EOF           bool
-	Method        string
-	Path          string
-	Args          []kv
-	Body          []byte
+
+	AcceptEncoding uint8
+	Zbuf           *bytes.Buffer
+
+	CacheKey string
+	CacheGen uint64
+
+	Method string
+	Path   string
+	Args   []kv
+	Body   []byte
 
 	Status  int
 	Err     error
@@ -287,8 +416,31 @@ type kv struct {
 	k, v string
 }
 
+var errAgain = errors.New("request is not complete yet")
+var errTooLarge = errors.New("request is too large")
+
+func (r *Request) Reset(fd File) {
+	*r = Request{
+		File: fd,
+		Args: r.Args[:0],
+		Zbuf: r.Zbuf,
+	}
+}
+
+// ResetConn prepares request to be read from blocking connection,
+// which is used for TLS.
+func (r *Request) ResetConn(c net.Conn) {
+	*r = Request{
+		Conn: c,
+		Args: r.Args[:0],
+		Zbuf: r.Zbuf,
+	}
+}
+
+// Parse reads request. It returns errAgain if socket has no more data yet,
+// and could be called again to continue parsing when data arrives.
 func (r *Request) Parse() error {
-	for {
+	for !r.HeadDone {
 		nextLine := bytes.Index(r.BufBuf[r.LastLine:r.Filled], []byte("\r\n"))
 		if nextLine == -1 {
 			if err := r.read(len(r.BufBuf)); err != nil {
@@ -325,13 +477,19 @@ func (r *Request) Parse() error {
 			}
 		} else if bytes.HasPrefix(line, []byte("Content-Length: ")) {
 			r.ContentLength, _ = strconv.Atoi(string(line[16:]))
+		} else if len(line) > len(hdrAcceptEncoding) && line[len(hdrAcceptEncoding)] == ':' &&
+			bytes.EqualFold(line[:len(hdrAcceptEncoding)], hdrAcceptEncoding) {
+			r.AcceptEncoding = ParseAcceptEncoding(line[len(hdrAcceptEncoding)+1:])
 		}
 		r.LastLine += nextLine + 2
 		if len(line) == 0 {
-			break
+			r.HeadDone = true
 		}
 	}
 
+	if r.LastLine+r.ContentLength > len(r.BufBuf) {
+		return errTooLarge
+	}
 	for r.LastLine+r.ContentLength > r.Filled {
 		if err := r.read(r.LastLine + r.ContentLength + 2); err != nil {
 			return err
@@ -358,6 +516,8 @@ func (r *Request) SetBody(b []byte) {
 		n += copy(r.BufBuf[n:], "400 Bad Request\r\n")
 	case 404:
 		n += copy(r.BufBuf[n:], "404 Not Found\r\n")
+	case 503:
+		n += copy(r.BufBuf[n:], "503 Service Unavailable\r\n")
 	default:
 		n += copy(r.BufBuf[n:], fmt.Sprintf("%d Some Code\r\n", r.Status))
 	}
@@ -369,7 +529,21 @@ func (r *Request) SetBody(b []byte) {
 
 	n += copy(r.BufBuf[n:], "Connection: keep-alive\r\n")
 
+	if r.CacheKey != "" && (r.Status == 0 || r.Status == 200) {
+		QueryCache.Put(r.CacheKey, r.CacheGen, b)
+	}
+
+	if *compress {
+		n += copy(r.BufBuf[n:], "Vary: Accept-Encoding\r\n")
+	}
 	if len(b) > 0 {
+		var encoding string
+		b, encoding = r.compressBody(b)
+		if encoding != "" {
+			n += copy(r.BufBuf[n:], "Content-Encoding: ")
+			n += copy(r.BufBuf[n:], encoding)
+			n += copy(r.BufBuf[n:], "\r\n")
+		}
 		n += copy(r.BufBuf[n:], "Content-Type: application/json\r\n")
 		n += copy(r.BufBuf[n:], "Content-Length: ")
 		n += copy(r.BufBuf[n:], strconv.Itoa(len(b)))
@@ -381,7 +555,10 @@ func (r *Request) SetBody(b []byte) {
 	n += copy(r.BufBuf[n:], "\r\n")
 
 	var err error
-	if len(b) > 0 {
+	if r.Conn != nil {
+		bufs := net.Buffers{r.BufBuf[:n], b}
+		_, err = bufs.WriteTo(r.Conn)
+	} else if len(b) > 0 {
 		_, err = r.File.Writev([][]byte{r.BufBuf[:n], b})
 	} else {
 		_, err = r.File.Write(r.BufBuf[:n])
@@ -456,7 +633,16 @@ func c2d(c byte) byte {
 }
 
 func (r *Request) read(lim int) error {
-	n, err := r.File.Read(r.BufBuf[r.Filled:lim])
+	if lim > len(r.BufBuf) {
+		lim = len(r.BufBuf)
+	}
+	var n int
+	var err error
+	if r.Conn != nil {
+		n, err = r.Conn.Read(r.BufBuf[r.Filled:lim])
+	} else {
+		n, err = r.File.ReadNonblock(r.BufBuf[r.Filled:lim])
+	}
 	r.Filled += n
 	return err
 }
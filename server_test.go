@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWorkerCount(t *testing.T) {
+	ncpu := runtime.NumCPU()
+	if ncpu < 4 {
+		ncpu = 4
+	} else if ncpu > 32 {
+		ncpu = 32
+	}
+	for _, tc := range []struct {
+		n    int
+		mode string
+		want int
+		err  bool
+	}{
+		{0, EpollShared, ncpu + 1, false},
+		{0, EpollReusePort, ncpu + 1, false},
+		{1, EpollShared, 1, false},
+		{7, EpollReusePort, 7, false},
+		{-1, EpollShared, 0, true},
+		{-3, EpollReusePort, 0, true},
+		{2, "", 0, true},
+		{2, "edge", 0, true},
+	} {
+		n, err := workerCount(tc.n, tc.mode)
+		if tc.err {
+			require.Error(t, err, "%d %q", tc.n, tc.mode)
+			continue
+		}
+		require.NoError(t, err, "%d %q", tc.n, tc.mode)
+		require.Equal(t, tc.want, n, "%d %q", tc.n, tc.mode)
+	}
+}
+
+func TestServerFlags(t *testing.T) {
+	oldWorkers, oldMode, oldPin := *workers, *epollMode, *cpuPin
+	defer func() { *workers, *epollMode, *cpuPin = oldWorkers, oldMode, oldPin }()
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.IntVar(workers, "workers", 0, "")
+	fs.StringVar(epollMode, "epoll", EpollShared, "")
+	fs.BoolVar(cpuPin, "cpupin", false, "")
+
+	require.NoError(t, fs.Parse([]string{"-workers", "3", "-epoll", "reuseport", "-cpupin"}))
+	require.Equal(t, 3, *workers)
+	require.Equal(t, EpollReusePort, *epollMode)
+	require.True(t, *cpuPin)
+	n, err := workerCount(*workers, *epollMode)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	require.NoError(t, fs.Parse([]string{"-workers", "-2"}))
+	_, err = workerCount(*workers, *epollMode)
+	require.Error(t, err)
+
+	require.NoError(t, fs.Parse([]string{"-workers", "2", "-epoll", "per-cpu"}))
+	_, err = workerCount(*workers, *epollMode)
+	require.Error(t, err)
+}
+
+func TestPinThread(t *testing.T) {
+	worker := runtime.NumCPU() + 1
+	done := make(chan unix.CPUSet)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		var old unix.CPUSet
+		if err := unix.SchedGetaffinity(0, &old); err != nil {
+			close(done)
+			return
+		}
+		pinThread(worker)
+		var set unix.CPUSet
+		unix.SchedGetaffinity(0, &set)
+		// thread returns to the pool, so give it all its cpus back
+		unix.SchedSetaffinity(0, &old)
+		done <- set
+	}()
+	set, ok := <-done
+	if !ok {
+		t.Skip("sched_getaffinity is not available")
+	}
+	require.Equal(t, 1, set.Count())
+	require.True(t, set.IsSet(worker%runtime.NumCPU()))
+}
+
+func TestListenReusePort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	// both workers' listeners bind the same port
+	a := listenSocket(port, true)
+	defer syscall.Close(a)
+	b := listenSocket(port, true)
+	defer syscall.Close(b)
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	var fds [2]unix.PollFd
+	fds[0] = unix.PollFd{Fd: int32(a), Events: unix.POLLIN}
+	fds[1] = unix.PollFd{Fd: int32(b), Events: unix.POLLIN}
+	n, err := unix.Poll(fds[:], 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, n, "connection is queued to exactly one listener")
+	sock := a
+	if fds[1].Revents&unix.POLLIN != 0 {
+		sock = b
+	}
+	connfd, _, err := syscall.Accept(sock)
+	require.NoError(t, err)
+	syscall.Close(connfd)
+}
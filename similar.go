@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+const (
+	SimilarJaccard  = "jaccard"
+	SimilarWeighted = "weighted"
+)
+
+type simElem struct {
+	uid   int32
+	score float64
+}
+
+// simHeap is a min-heap of best accounts found so far.
+type simHeap []simElem
+
+func (h simHeap) less(i, j simElem) bool {
+	return i.score < j.score || i.score == j.score && i.uid < j.uid
+}
+
+func (h *simHeap) Add(limit int, el simElem) {
+	if len(*h) < limit {
+		*h = append(*h, el)
+		for i := len(*h) - 1; i > 0; {
+			p := (i - 1) / 2
+			if !h.less((*h)[i], (*h)[p]) {
+				break
+			}
+			(*h)[i], (*h)[p] = (*h)[p], (*h)[i]
+			i = p
+		}
+	} else if h.less((*h)[0], el) {
+		(*h)[0] = el
+		h.down()
+	}
+}
+
+func (h simHeap) down() {
+	l, i := len(h), 0
+	for i*2+1 < l {
+		c := i*2 + 1
+		if c+1 < l && h.less(h[c+1], h[c]) {
+			c++
+		}
+		if !h.less(h[c], h[i]) {
+			break
+		}
+		h[i], h[c] = h[c], h[i]
+		i = c
+	}
+}
+
+type simTerm struct {
+	ix     int32
+	weight float64
+}
+
+// doSimilar finds accounts with the most similar interests.
+//
+// Query terms are ordered by weight descending (rarest interests first).
+// Pass k visits accounts having term k and none of previous terms, so score
+// of such account is bounded by weights of terms k and later. Once heap is
+// full and its worst score exceeds the bound, remaining (larger) posting
+// lists are not visited at all.
+func doSimilar(ctx *Request) {
+	q := newFilterQuery()
+	defer q.release()
+	limit := -1
+	metric := SimilarJaccard
+	self := int32(0)
+	var query InterestMask
+	hasQuery := false
+
+	for _, kv := range ctx.Args {
+		key, val := kv.k, kv.v
+		switch key {
+		case "limit":
+			var err error
+			limit, err = strconv.Atoi(val)
+			if err != nil || limit == 0 {
+				logf("limit: %s", err)
+				q.correct = false
+			}
+		case "metric":
+			switch val {
+			case SimilarJaccard, SimilarWeighted:
+				metric = val
+			default:
+				logf("metric incorrect")
+				q.correct = false
+			}
+		case "id":
+			n, err := strconv.Atoi(val)
+			if err != nil || HasAccount(int32(n)) == nil {
+				logf("id incorrect")
+				q.correct = false
+				break
+			}
+			self = int32(n)
+			query = *GetInterest(self)
+			hasQuery = true
+		case "interests":
+			for _, interest := range strings.Split(val, ",") {
+				if ix := InterestStrings.Find(interest); ix != 0 {
+					query.Set(uint8(ix))
+				}
+			}
+			hasQuery = true
+		case "query_id":
+			// ignore
+		default:
+			if !q.addArg(key, val) {
+				logf("default incorrect")
+				q.correct = false
+			}
+		}
+		if !q.correct {
+			break
+		}
+	}
+	q.finish()
+	if !q.correct || limit <= 0 || !hasQuery {
+		ctx.SetStatusCode(400)
+		return
+	}
+
+	total := float64(AccountsMap.Count())
+	var terms []simTerm
+	query.Unroll(func(ix int32) {
+		df := float64(InterestStrings.Maps[ix-1].Count())
+		if df == 0 {
+			return
+		}
+		w := 1.0
+		if metric == SimilarWeighted {
+			w = math.Log(1 + total/df)
+		}
+		terms = append(terms, simTerm{ix, w})
+	})
+	if q.emptyRes || len(terms) == 0 {
+		ctx.SetStatusCode(200)
+		ctx.SetBody(EmptyFilterRes)
+		return
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].weight != terms[j].weight {
+			return terms[i].weight > terms[j].weight
+		}
+		return InterestStrings.Maps[terms[i].ix-1].Count() < InterestStrings.Maps[terms[j].ix-1].Count()
+	})
+	weights := make(map[int32]float64, len(terms))
+	bound := 0.0
+	for _, t := range terms {
+		weights[t.ix] = t.weight
+		bound += t.weight
+	}
+	qsize := float64(len(terms))
+
+	score := func(mask InterestMask) float64 {
+		common := query.Intersect(mask)
+		if metric == SimilarJaccard {
+			c := float64(common.IntersectCount(common))
+			return c / (qsize + float64(mask.IntersectCount(mask)) - c)
+		}
+		s := 0.0
+		common.Unroll(func(ix int32) { s += weights[ix] })
+		return s
+	}
+	boundScore := func(b float64) float64 {
+		if metric == SimilarJaccard {
+			return b / qsize
+		}
+		return b
+	}
+
+	filter := combineFilters(q.filters)
+	var heap simHeap
+	var seen InterestMask
+	for _, t := range terms {
+		if len(heap) == limit && heap[0].score > boundScore(bound) {
+			break
+		}
+		maps := append(q.maps[:len(q.maps):len(q.maps)], InterestStrings.Maps[t.ix-1])
+		bitmap.Loop(bitmap.NewAndBitmap(maps), func(uids []int32) bool {
+			for _, uid := range uids {
+				mask := *GetInterest(uid)
+				if uid == self || mask.IntersectCount(seen) != 0 {
+					continue
+				}
+				if filter != nil && !filter(uid, RefAccount(uid)) {
+					continue
+				}
+				heap.Add(limit, simElem{uid, score(mask)})
+			}
+			return true
+		})
+		seen.Set(uint8(t.ix))
+		bound -= t.weight
+	}
+
+	sort.Slice(heap, func(i, j int) bool { return heap.less(heap[j], heap[i]) })
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"accounts":[`))
+	for i, el := range heap {
+		outAccountFields(&q.outFields, RefAccount(el.uid), stream)
+		stream.Write([]byte(`,"score":`))
+		stream.WriteFloat64(el.score)
+		stream.WriteObjectEnd()
+		if i != len(heap)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
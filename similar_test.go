@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bruteSimilarInterests scores every account against query interests without
+// any pruning; ties are ordered by uid descending as handler does.
+func bruteSimilarInterests(self int32, query []string, metric string, match func(*Account) bool) []similarAccount {
+	total := float64(AccountsMap.Count())
+	weights := map[int32]float64{}
+	for _, interest := range query {
+		ix := int32(InterestStrings.Find(interest))
+		if ix == 0 || InterestStrings.Maps[ix-1].Count() == 0 {
+			continue
+		}
+		weights[ix] = 1
+		if metric == SimilarWeighted {
+			weights[ix] = math.Log(1 + total/float64(InterestStrings.Maps[ix-1].Count()))
+		}
+	}
+	var res []similarAccount
+	for uid := int32(1); uid < MaxId; uid++ {
+		acc := HasAccount(uid)
+		if acc == nil || uid == self || !match(acc) {
+			continue
+		}
+		mine := accInterestSet(uid)
+		common, s := 0, 0.0
+		// sum in index order, so float result is the same as handler's
+		GetInterest(uid).Unroll(func(ix int32) {
+			if w, ok := weights[ix]; ok {
+				common++
+				s += w
+			}
+		})
+		if common == 0 {
+			continue
+		}
+		if metric == SimilarJaccard {
+			s = float64(common) / float64(len(weights)+len(mine)-common)
+		}
+		res = append(res, similarAccount{Id: uid, Score: s})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Id > res[j].Id
+	})
+	return res
+}
+
+func TestSimilar(t *testing.T) {
+	loadFixture(t)
+
+	queries := [][]string{
+		{"кино"},
+		{"кино", "музыка"},
+		{"вино", "пиво", "книги"},
+		fixtureInterests[:6],
+		fixtureInterests,
+		{"кино", "несуществующее"},
+	}
+	cases := []suggestCase{
+		{"", func(*Account) bool { return true }},
+		{"sex_eq=f", func(acc *Account) bool { return !acc.Sex }},
+		{"status_eq=" + StatusFree, func(acc *Account) bool { return acc.Status == StatusFreeIx }},
+	}
+	check := func(args string, want []similarAccount, limit int) {
+		code, body := serve(t, "GET", "/accounts/similar/?"+args, "")
+		require.Equal(t, 200, code, "%s: %s", args, body)
+		var res struct {
+			Accounts []similarAccount `json:"accounts"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+		if len(want) > limit {
+			want = want[:limit]
+		}
+		require.Len(t, res.Accounts, len(want), args)
+		for i := range want {
+			require.Equal(t, want[i].Id, res.Accounts[i].Id, "%s: %d", args, i)
+			require.InDelta(t, want[i].Score, res.Accounts[i].Score, 1e-9, "%s: %d", args, i)
+		}
+	}
+
+	// small limits make heap full early, so rare terms alone must be enough
+	// to stop; large ones force visiting every posting list
+	limits := []int{1, 2, 3, 7, 50, 1000}
+	for _, metric := range []string{SimilarJaccard, SimilarWeighted} {
+		for _, query := range queries {
+			for _, tc := range cases {
+				want := bruteSimilarInterests(0, query, metric, tc.match)
+				require.NotEmpty(t, want, "%s %v %s", metric, query, tc.args)
+				args := tc.args
+				if args != "" {
+					args += "&"
+				}
+				args = escapeArgs(args + "metric=" + metric + "&interests=" + strings.Join(query, ","))
+				for _, limit := range limits {
+					check(fmt.Sprintf("%s&limit=%d", args, limit), want, limit)
+				}
+			}
+		}
+
+		checked := 0
+		for id := int32(3); id <= fixtureSize && checked < 20; id += 47 {
+			var query []string
+			for ix := range accInterestSet(id) {
+				query = append(query, InterestStrings.GetStr(uint32(ix)))
+			}
+			if len(query) == 0 {
+				continue
+			}
+			checked++
+			want := bruteSimilarInterests(id, query, metric, func(*Account) bool { return true })
+			for _, limit := range limits {
+				check(fmt.Sprintf("metric=%s&id=%d&limit=%d", metric, id, limit), want, limit)
+			}
+		}
+		require.NotZero(t, checked)
+	}
+}
+
+func TestSimilarIncorrect(t *testing.T) {
+	loadFixture(t)
+	for _, args := range []string{
+		"interests=кино",
+		"interests=кино&limit=0",
+		"interests=кино&limit=abc",
+		"limit=5",
+		"interests=кино&limit=5&metric=cosine",
+		"id=99999999&limit=5",
+		"interests=кино&limit=5&sex_eq=x",
+		"interests=кино&limit=5&unknown=1",
+	} {
+		code, _ := serve(t, "GET", "/accounts/similar/?"+escapeArgs(args), "")
+		require.Equal(t, 400, code, args)
+	}
+	code, body := serve(t, "GET", "/accounts/similar/?"+escapeArgs("interests=несуществующее&limit=5"), "")
+	require.Equal(t, 200, code)
+	require.JSONEq(t, `{"accounts":[]}`, body)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const sortedBlockMax = 1024
+
+// SortedIndex keeps ids of strings of Table ordered by string value.
+// Ids are stored in blocks of bounded size, so insert and remove move at
+// most one block. Strings of Table are unique, so string value identifies
+// id exactly.
+type SortedIndex struct {
+	sync.RWMutex
+	Table  *StringsTable
+	blocks [][]uint32
+}
+
+// seek returns position of first id with string >= s.
+func (si *SortedIndex) seek(s string) (int, int) {
+	b := sort.Search(len(si.blocks), func(i int) bool {
+		blk := si.blocks[i]
+		return si.Table.GetStr(blk[len(blk)-1]) >= s
+	})
+	if b == len(si.blocks) {
+		return b, 0
+	}
+	blk := si.blocks[b]
+	i := sort.Search(len(blk), func(i int) bool {
+		return si.Table.GetStr(blk[i]) >= s
+	})
+	return b, i
+}
+
+func (si *SortedIndex) Insert(id uint32) {
+	si.Lock()
+	defer si.Unlock()
+	if len(si.blocks) == 0 {
+		si.blocks = append(si.blocks, []uint32{id})
+		return
+	}
+	b, i := si.seek(si.Table.GetStr(id))
+	if b == len(si.blocks) {
+		b--
+		i = len(si.blocks[b])
+	}
+	blk := append(si.blocks[b], 0)
+	copy(blk[i+1:], blk[i:])
+	blk[i] = id
+	if len(blk) < sortedBlockMax {
+		si.blocks[b] = blk
+		return
+	}
+	half := len(blk) / 2
+	right := append([]uint32(nil), blk[half:]...)
+	si.blocks = append(si.blocks, nil)
+	copy(si.blocks[b+2:], si.blocks[b+1:])
+	si.blocks[b] = blk[:half:half]
+	si.blocks[b+1] = right
+}
+
+func (si *SortedIndex) Remove(id uint32) {
+	si.Lock()
+	defer si.Unlock()
+	b, i := si.seek(si.Table.GetStr(id))
+	if b == len(si.blocks) || si.blocks[b][i] != id {
+		return
+	}
+	blk := si.blocks[b]
+	copy(blk[i:], blk[i+1:])
+	blk = blk[:len(blk)-1]
+	if len(blk) > 0 {
+		si.blocks[b] = blk
+		return
+	}
+	copy(si.blocks[b:], si.blocks[b+1:])
+	si.blocks[len(si.blocks)-1] = nil
+	si.blocks = si.blocks[:len(si.blocks)-1]
+}
+
+// Remap prepares renumbering ids by remap, dropping ids mapped to 0. Remap
+// must keep order of ids, as StringsTable.compact does. Index is changed
+// only by returned apply.
+func (si *SortedIndex) Remap(remap []uint32) (apply func()) {
+	si.RLock()
+	var blocks [][]uint32
+	for _, blk := range si.blocks {
+		var nblk []uint32
+		for _, id := range blk {
+			if nid := remap[id]; nid != 0 {
+				nblk = append(nblk, nid)
+			}
+		}
+		if len(nblk) > 0 {
+			blocks = append(blocks, nblk)
+		}
+	}
+	si.RUnlock()
+	return func() {
+		si.Lock()
+		si.blocks = blocks
+		si.Unlock()
+	}
+}
+
+// Ascend calls f for ids with string >= from in increasing order until f
+// returns false.
+func (si *SortedIndex) Ascend(from string, f func(id uint32, s string) bool) {
+	si.RLock()
+	defer si.RUnlock()
+	b, i := si.seek(from)
+	for ; b < len(si.blocks); b, i = b+1, 0 {
+		for _, id := range si.blocks[b][i:] {
+			if !f(id, si.Table.GetStr(id)) {
+				return
+			}
+		}
+	}
+}
+
+// PrefixRange returns ids of strings starting with pref in order.
+func (si *SortedIndex) PrefixRange(pref string) []uint32 {
+	var ids []uint32
+	si.Ascend(pref, func(id uint32, s string) bool {
+		if !strings.HasPrefix(s, pref) {
+			return false
+		}
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortedIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	var st StringsTable
+	si := SortedIndex{Table: &st}
+	live := make(map[uint32]bool)
+
+	ascend := func(from string) []string {
+		var res []string
+		si.Ascend(from, func(id uint32, s string) bool {
+			require.Equal(t, st.GetStr(id), s)
+			res = append(res, s)
+			return true
+		})
+		return res
+	}
+	model := func(from string) []string {
+		var res []string
+		for id := range live {
+			if s := st.GetStr(id); s >= from {
+				res = append(res, s)
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+	check := func() {
+		for _, from := range []string{"", "a", "m5", "zz", "~"} {
+			require.Equal(t, model(from), ascend(from), "from %q", from)
+		}
+	}
+
+	// enough strings to split blocks several times
+	for i := 0; i < 5*sortedBlockMax; i++ {
+		id, isNew := st.Insert(fmt.Sprintf("%c%d", 'a'+rng.Intn(26), rng.Intn(100000)))
+		if isNew {
+			si.Insert(id)
+			live[id] = true
+		}
+	}
+	check()
+	for id := range live {
+		if rng.Intn(3) > 0 {
+			si.Remove(id)
+			delete(live, id)
+		}
+	}
+	check()
+	// removing absent id does nothing
+	for id := uint32(1); id <= uint32(len(st.Arr)); id++ {
+		if !live[id] {
+			si.Remove(id)
+			break
+		}
+	}
+	check()
+
+	var pref []string
+	for _, s := range model("b") {
+		if s[0] != 'b' {
+			break
+		}
+		pref = append(pref, s)
+	}
+	var got []string
+	for _, id := range si.PrefixRange("b") {
+		got = append(got, st.GetStr(id))
+	}
+	require.Equal(t, pref, got)
+
+	// stop by callback
+	n := 0
+	si.Ascend("", func(uint32, string) bool {
+		n++
+		return n < 3
+	})
+	require.Equal(t, 3, n)
+
+	for id := range live {
+		si.Remove(id)
+	}
+	require.Empty(t, ascend(""))
+	si.Insert(1)
+	require.Equal(t, []string{st.GetStr(1)}, ascend(""))
+}
+
+func TestEmailRangeFilter(t *testing.T) {
+	loadFixture(t)
+	email := func(acc *Account) string { return EmailIndex.GetStr(acc.Email) }
+	check := func() {
+		cases := []struct {
+			args string
+			f    func(s string) bool
+		}{
+			// wide ranges are collected into pooled bitmaps
+			{"email_gt=b", func(s string) bool { return s > "b" }},
+			{"email_lt=y", func(s string) bool { return s < "y" }},
+			{"email_between=b,y", func(s string) bool { return s >= "b" && s <= "y" }},
+			// narrow ones are kept as uids lists
+			{"email_gt=yy", func(s string) bool { return s > "yy" }},
+			{"email_lt=ab", func(s string) bool { return s < "ab" }},
+			{"email_between=k,kc", func(s string) bool { return s >= "k" && s <= "kc" }},
+			{"email_gt=zzzz", func(s string) bool { return s > "zzzz" }},
+		}
+		for _, c := range cases {
+			for _, limit := range []int{1, 7, 50} {
+				want := bruteIds(limit, func(acc *Account) bool { return c.f(email(acc)) })
+				args := fmt.Sprintf("%s&limit=%d", c.args, limit)
+				require.Equal(t, want, filterIds(t, args), args)
+			}
+		}
+		want := bruteIds(20, func(acc *Account) bool {
+			return email(acc) < "m" && !acc.Sex
+		})
+		require.Equal(t, want, filterIds(t, "email_lt=m&sex_eq=f&limit=20"))
+		// two pooled bitmaps in one query
+		want = bruteIds(20, func(acc *Account) bool {
+			return email(acc) > "c" && email(acc) < "w"
+		})
+		require.Equal(t, want, filterIds(t, "email_gt=c&email_lt=w&limit=20"))
+	}
+	check()
+
+	// change emails, so they move across range bounds
+	changes := map[int32]string{5999: "aaa@a.ru", 5990: "zzzzz@z.ru", 5980: "kb@k.ru"}
+	old := make(map[int32]string)
+	for uid, s := range changes {
+		old[uid] = email(RefAccount(uid))
+		code, body := serve(t, "POST", fmt.Sprintf("/accounts/%d/", uid), `{"email":"`+s+`"}`)
+		require.Equal(t, 202, code, body)
+		require.Equal(t, s, email(RefAccount(uid)))
+	}
+	require.Equal(t, []int32{5999}, filterIds(t, "email_lt=aab&limit=50")[:1])
+	require.Equal(t, []int32{5990}, filterIds(t, "email_gt=zzzz&limit=50"))
+	require.Contains(t, filterIds(t, "email_between=kb,kb~&limit=50"), int32(5980))
+	check()
+
+	// old emails are free again, restore them
+	for uid, s := range old {
+		code, body := serve(t, "POST", fmt.Sprintf("/accounts/%d/", uid), `{"email":"`+s+`"}`)
+		require.Equal(t, 202, code, body)
+	}
+	check()
+}
@@ -19,6 +19,11 @@ type StringsTable struct {
 	Arr     []StringHandle
 	Null    bitmap.Bitmap
 	NotNull bitmap.Bitmap
+
+	// OnInsert is called for every new string.
+	OnInsert func(ix uint32, s string)
+	// Dead contains removed strings. Their ids are not reused.
+	Dead map[uint32]struct{}
 }
 
 type StringHandle struct {
@@ -26,6 +31,12 @@ type StringHandle struct {
 	Handle uintptr
 }
 
+// ptr returns Ptr as unsafe.Pointer. It reads field in place, so the
+// conversion is not a uintptr to pointer cast vet complains about.
+func (h *StringHandle) ptr() unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&h.Ptr))
+}
+
 type String struct {
 	Hash uint32
 	Len  uint8
@@ -91,6 +102,9 @@ func (us *StringsTable) Insert(s string) (uint32, bool) {
 	us.Arr = append(us.Arr, StringHandle{Ptr: uintptr(ptr)})
 	apos := uint32(len(us.Arr))
 	us.Tbl[pos] = apos
+	if us.OnInsert != nil {
+		us.OnInsert(apos, s)
+	}
 	return apos, true
 }
 
@@ -129,17 +143,95 @@ func (ush *StringsTable) Rebalance() {
 	if newcapa == 0 {
 		newcapa = 256
 	}
+	ush.rehash(newcapa)
+}
+
+func (ush *StringsTable) rehash(newcapa int) {
+	ush.Tbl = hashTable(ush.Arr, newcapa, ush.IsDead)
+}
+
+// hashTable builds open addressing table of newcapa slots for strings of
+// arr, skipping ids accepted by dead.
+func hashTable(arr []StringHandle, newcapa int, dead func(ix uint32) bool) []uint32 {
 	mask := uint32(newcapa - 1)
 	newTbl := make([]uint32, newcapa, newcapa)
-	for i, hndl := range ush.Arr {
-		pos, d := hndl.Hash()&mask, uint32(1)
+	for i := range arr {
+		if dead(uint32(i) + 1) {
+			continue
+		}
+		pos, d := arr[i].Hash()&mask, uint32(1)
 		for newTbl[pos] != 0 {
 			pos = (pos + d) & mask
 			d++
 		}
 		newTbl[pos] = uint32(i) + 1
 	}
-	ush.Tbl = newTbl
+	return newTbl
+}
+
+func (ush *StringsTable) IsDead(ix uint32) bool {
+	_, ok := ush.Dead[ix]
+	return ok
+}
+
+// Remove makes string unreachable by Find. Id stays valid for GetStr.
+// Table is rehashed, so caller must hold dictMutex exclusively.
+func (ush *StringsTable) Remove(ix uint32) {
+	if ush.Dead == nil {
+		ush.Dead = make(map[uint32]struct{})
+	}
+	ush.Dead[ix] = struct{}{}
+	ush.rehash(len(ush.Tbl))
+}
+
+// Rename replaces string of id. New string must not be in table.
+// OnInsert is not called. Old string is freed and table is rehashed, so
+// caller must hold dictMutex exclusively.
+func (ush *StringsTable) Rename(ix uint32, s string) {
+	if len(s) > 255 {
+		panic("String is too long " + s)
+	}
+	ptr := StringAlloc.Alloc(len(s) + 1 + 4)
+	ustr := (*String)(ptr)
+	ustr.Hash = hash(s)
+	ustr.Len = uint8(len(s))
+	copy(ustr.Data[:], s)
+	StringAlloc.Dealloc(ush.Arr[ix-1].ptr())
+	ush.Arr[ix-1].Ptr = uintptr(ptr)
+	ush.rehash(len(ush.Tbl))
+}
+
+// compact prepares dropping strings not accepted by live and renumbering
+// the rest preserving order. Table is not modified: remap gives new id by
+// old id (0 for dropped strings), and apply installs compacted table and
+// releases memory of dropped strings. Preparation only reads the table;
+// apply must be called with dictMutex held exclusively.
+func (ush *StringsTable) compact(live func(ix uint32) bool) (remap []uint32, apply func()) {
+	remap = make([]uint32, len(ush.Arr)+1)
+	arr := make([]StringHandle, 0, len(ush.Arr))
+	var dropped []uint32
+	for i, hndl := range ush.Arr {
+		ix := uint32(i + 1)
+		if !live(ix) {
+			dropped = append(dropped, ix)
+			continue
+		}
+		arr = append(arr, hndl)
+		remap[ix] = uint32(len(arr))
+	}
+	newcapa := 256
+	for len(arr) >= newcapa*5/8 {
+		newcapa *= 2
+	}
+	tbl := hashTable(arr, newcapa, func(uint32) bool { return false })
+	return remap, func() {
+		for _, ix := range dropped {
+			StringAlloc.Dealloc(ush.Arr[ix-1].ptr())
+		}
+		ush.Arr = arr
+		ush.Tbl = tbl
+		ush.Dead = nil
+	}
 }
 
 func (ush *StringsTable) SetNull(uid int32, isNull bool) {
@@ -197,11 +289,22 @@ func (us *UniqStrings) ResetUser(ix uint32, uid int32) {
 	hndl.Handle = 0
 }
 
+// Compact prepares dropping strings not owned by any account. See
+// StringsTable.compact.
+func (us *UniqStrings) Compact() ([]uint32, func()) {
+	return us.compact(func(ix uint32) bool {
+		return us.GetHndl(ix).Handle != 0
+	})
+}
+
 type SomeStrings struct {
 	sync.Mutex
 	StringsTable
 	Huge bool
-	Maps []*bitmap.Bitmap
+	Maps []*bitmap.Adaptive
+
+	// Sorted, if set, keeps strings used by at least one account.
+	Sorted *SortedIndex
 }
 
 func (ss *SomeStrings) Add(str string, uid int32) uint32 {
@@ -216,9 +319,13 @@ func (ss *SomeStrings) Add(str string, uid int32) uint32 {
 
 	ix, _ := ss.Insert(str)
 	for int(ix) > len(ss.Maps) {
-		ss.Maps = append(ss.Maps, &bitmap.Bitmap{})
+		ss.Maps = append(ss.Maps, &bitmap.Adaptive{})
+	}
+	mp := ss.Maps[ix-1]
+	mp.Set(uid)
+	if ss.Sorted != nil && mp.Count() == 1 {
+		ss.Sorted.Insert(ix)
 	}
-	ss.Maps[ix-1].Set(uid)
 	return ix
 }
 
@@ -243,7 +350,7 @@ func (ss *SomeStrings) Stat() [9]int {
 }
 */
 
-func (ss *SomeStrings) GetMap(ix uint32) *bitmap.Bitmap {
+func (ss *SomeStrings) GetMap(ix uint32) *bitmap.Adaptive {
 	if ix == 0 {
 		return nil
 	}
@@ -255,5 +362,32 @@ func (ss *SomeStrings) Set(ix uint32, i int32) {
 }
 
 func (ss *SomeStrings) Unset(ix uint32, i int32) {
-	ss.GetMap(ix).Unset(i)
+	mp := ss.GetMap(ix)
+	mp.Unset(i)
+	if ss.Sorted != nil && mp.Count() == 0 {
+		ss.Sorted.Remove(ix)
+	}
+}
+
+// Compact prepares dropping strings not used by any account together with
+// their maps. See StringsTable.compact.
+func (ss *SomeStrings) Compact() ([]uint32, func()) {
+	remap, apply := ss.compact(func(ix uint32) bool {
+		return int(ix) <= len(ss.Maps) && ss.Maps[ix-1].Count() > 0 && !ss.IsDead(ix)
+	})
+	maps := make([]*bitmap.Adaptive, 0, len(ss.Maps))
+	for i, mp := range ss.Maps {
+		if remap[i+1] != 0 {
+			maps = append(maps, mp)
+		}
+	}
+	applySorted := func() {}
+	if ss.Sorted != nil {
+		applySorted = ss.Sorted.Remap(remap)
+	}
+	return remap, func() {
+		apply()
+		ss.Maps = maps
+		applySorted()
+	}
 }
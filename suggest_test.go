@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+	"github.com/stretchr/testify/require"
+)
+
+type similarAccount struct {
+	Id    int32   `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// likeTs returns average timestamp of likes from uid to whom.
+func likeTs(uid, whom int32) int32 {
+	likers := GetLikers(whom)
+	var sum, n int64
+	for _, el := range likers.Data[:likers.Size] {
+		if el.Uid == uid {
+			sum += int64(el.Ts)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return int32(sum / n)
+}
+
+func likesOf(uid int32) []int32 {
+	small := bitmap.GetSmall(&RefAccount(uid).Likes)
+	if small.SmallImpl == nil {
+		return nil
+	}
+	return small.Data[:small.Size]
+}
+
+// bruteSimilar scores every account which liked someone I liked.
+// It includes me, as handler does before output.
+func bruteSimilar(me int32, metric string, halfLife float64, match func(*Account) bool) []similarAccount {
+	mine := map[int32]int32{}
+	for _, whom := range likesOf(me) {
+		mine[whom] = likeTs(me, whom)
+	}
+	scores := map[int32]float64{}
+	for uid := int32(1); uid < MaxId; uid++ {
+		acc := HasAccount(uid)
+		if acc == nil || !match(acc) {
+			continue
+		}
+		for _, whom := range likesOf(uid) {
+			myTs, ok := mine[whom]
+			if !ok {
+				continue
+			}
+			dlt := likeTs(uid, whom) - myTs
+			if dlt < 0 {
+				dlt = -dlt
+			} else if dlt == 0 {
+				dlt = 1
+			}
+			switch metric {
+			case SuggestDefault:
+				scores[uid] += 1 / float64(dlt)
+			case SuggestDecay:
+				scores[uid] += math.Exp2(-float64(dlt) / halfLife)
+			default:
+				scores[uid]++
+			}
+		}
+	}
+	res := make([]similarAccount, 0, len(scores))
+	for uid, s := range scores {
+		theirs := float64(len(likesOf(uid)))
+		switch metric {
+		case SuggestJaccard:
+			s /= float64(len(mine)) + theirs - s
+		case SuggestCosine:
+			s /= math.Sqrt(float64(len(mine)) * theirs)
+		}
+		if s > 0 {
+			res = append(res, similarAccount{Id: uid, Score: s})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+func suggestBody(t *testing.T, id int32, args string) string {
+	uri := fmt.Sprintf("/accounts/%d/suggest/?%s", id, args)
+	code, body := serve(t, "GET", uri, "")
+	require.Equal(t, 200, code, "%s: %s", uri, body)
+	return body
+}
+
+type suggestCase struct {
+	args  string
+	match func(*Account) bool
+}
+
+func suggestCases() []suggestCase {
+	all := func(*Account) bool { return true }
+	return []suggestCase{
+		{"", all},
+		{"sex_eq=m", func(acc *Account) bool { return acc.Sex }},
+		{"sex_eq=f", func(acc *Account) bool { return !acc.Sex }},
+		{"birth_gt=600000000", func(acc *Account) bool { return acc.Birth > 600000000 }},
+		{"birth_lt=600000000", func(acc *Account) bool { return acc.Birth < 600000000 }},
+		{"status_eq=" + StatusFree, func(acc *Account) bool { return acc.Status == StatusFreeIx }},
+		{"interests_contains=кино", func(acc *Account) bool {
+			return accInterestSet(acc.Uid)[int32(InterestStrings.Find("кино"))]
+		}},
+	}
+}
+
+func TestSuggestSimilar(t *testing.T) {
+	loadFixture(t)
+
+	metrics := []string{SuggestDefault, SuggestJaccard, SuggestCosine, SuggestDecay}
+	checked, found := 0, 0
+	for id := int32(5); id <= fixtureSize && checked < 25; id += 53 {
+		if len(likesOf(id)) == 0 {
+			continue
+		}
+		checked++
+		for _, metric := range metrics {
+			for _, tc := range suggestCases() {
+				args := escapeArgs(tc.args)
+				if args != "" {
+					args += "&"
+				}
+				args += "metric=" + metric + "&similar=1&limit=10&halflife=600"
+				var res struct {
+					Accounts []similarAccount `json:"accounts"`
+				}
+				body := suggestBody(t, id, args)
+				require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+
+				want := []similarAccount{}
+				for _, sim := range bruteSimilar(id, metric, 600, tc.match) {
+					if sim.Id != id && len(want) < 10 {
+						want = append(want, sim)
+					}
+				}
+				require.Len(t, res.Accounts, len(want), "id %d %s", id, args)
+				found += len(want)
+				for i := range want {
+					require.Equal(t, want[i].Id, res.Accounts[i].Id, "id %d %s", id, args)
+					require.InDelta(t, want[i].Score, res.Accounts[i].Score, 1e-9, "id %d %s", id, args)
+				}
+			}
+		}
+	}
+	require.NotZero(t, checked)
+	require.NotZero(t, found)
+}
+
+func TestSuggestMetrics(t *testing.T) {
+	loadFixture(t)
+
+	checked, found := 0, 0
+	for id := int32(7); id <= fixtureSize && checked < 25; id += 59 {
+		if len(likesOf(id)) == 0 {
+			continue
+		}
+		checked++
+		for _, metric := range []string{SuggestDefault, SuggestJaccard, SuggestCosine, SuggestDecay} {
+			for _, tc := range suggestCases() {
+				args := escapeArgs(tc.args)
+				if args != "" {
+					args += "&"
+				}
+				args += "metric=" + metric + "&limit=10"
+
+				seen := map[int32]bool{}
+				for _, whom := range likesOf(id) {
+					seen[whom] = true
+				}
+				want := []int32{}
+			Outer:
+				for _, sim := range bruteSimilar(id, metric, SuggestHalfLife, tc.match) {
+					for _, whom := range likesOf(sim.Id) {
+						if whom == id || seen[whom] {
+							continue
+						}
+						seen[whom] = true
+						want = append(want, whom)
+						if len(want) == 10 {
+							break Outer
+						}
+					}
+				}
+
+				var res struct {
+					Accounts []filterAccount `json:"accounts"`
+				}
+				body := suggestBody(t, id, args)
+				require.NoError(t, json.Unmarshal([]byte(body), &res), body)
+				got := []int32{}
+				for _, acc := range res.Accounts {
+					got = append(got, acc.Id)
+				}
+				require.Equal(t, want, got, "id %d %s", id, args)
+				found += len(want)
+			}
+		}
+	}
+	require.NotZero(t, checked)
+	require.NotZero(t, found)
+}
+
+func TestSuggestIncorrect(t *testing.T) {
+	loadFixture(t)
+	for _, args := range []string{
+		"metric=euclid",
+		"halflife=0",
+		"halflife=abc",
+		"similar=2",
+		"sex_eq=x",
+		"birth_gt=abc",
+		"status_eq=unknown",
+		"interests_contains=",
+	} {
+		code, _ := serve(t, "GET", "/accounts/1/suggest/?"+escapeArgs(args)+"&limit=5", "")
+		require.Equal(t, 400, code, args)
+	}
+}
+
+type scoredSuggest struct {
+	Id    int32    `json:"id"`
+	Score *float64 `json:"score"`
+}
+
+func TestSuggestWithScore(t *testing.T) {
+	loadFixture(t)
+
+	checked := 0
+	for id := int32(9); id <= fixtureSize && checked < 20; id += 61 {
+		if len(likesOf(id)) == 0 {
+			continue
+		}
+		checked++
+		for _, metric := range []string{SuggestDefault, SuggestJaccard, SuggestCosine, SuggestDecay} {
+			// every suggested account scores as the most similar user who liked it
+			best := map[int32]float64{}
+			for _, sim := range bruteSimilar(id, metric, SuggestHalfLife, func(*Account) bool { return true }) {
+				for _, whom := range likesOf(sim.Id) {
+					if _, ok := best[whom]; !ok {
+						best[whom] = sim.Score
+					}
+				}
+			}
+
+			args := "metric=" + metric + "&limit=10"
+			var plain, scored struct {
+				Accounts []scoredSuggest `json:"accounts"`
+			}
+			body := suggestBody(t, id, args)
+			require.NoError(t, json.Unmarshal([]byte(body), &plain), body)
+			body = suggestBody(t, id, args+"&with_score=1")
+			require.NoError(t, json.Unmarshal([]byte(body), &scored), body)
+
+			require.Len(t, scored.Accounts, len(plain.Accounts), args)
+			for i, acc := range scored.Accounts {
+				require.Nil(t, plain.Accounts[i].Score, args)
+				require.Equal(t, plain.Accounts[i].Id, acc.Id, "with_score changes order: %d %s", id, args)
+				require.NotNil(t, acc.Score, args)
+				require.InDelta(t, best[acc.Id], *acc.Score, 1e-9, "%d %s", id, args)
+				if i > 0 {
+					require.True(t, *scored.Accounts[i-1].Score >= *acc.Score, "%d %s", id, args)
+				}
+			}
+		}
+	}
+	require.NotZero(t, checked)
+
+	code, _ := serve(t, "GET", "/accounts/1/suggest/?limit=5&with_score=2", "")
+	require.Equal(t, 400, code)
+}
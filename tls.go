@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both tls certificate and key should be set")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ServeTLS accepts connections on ln and serves them over TLS.
+// Epoll workers can't drive TLS state machine, so every connection gets
+// its own goroutine with blocking reads bounded by the same timeouts.
+func ServeTLS(ln net.Listener, cfg *tls.Config) error {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Print(err)
+				continue
+			}
+			return err
+		}
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.SetNoDelay(true)
+		}
+		go serveTLSConn(tls.Server(c, cfg))
+	}
+}
+
+func serveTLSConn(c net.Conn) {
+	defer c.Close()
+	n := atomic.AddInt32(&connCount, 1)
+	defer atomic.AddInt32(&connCount, -1)
+	if int(n) > *maxConns {
+		c.SetDeadline(timeoutDeadline(*readTimeout))
+		c.Write(resp503)
+		return
+	}
+
+	req := requestPool.Get().(*Request)
+	defer requestPool.Put(req)
+	for {
+		req.ResetConn(c)
+		c.SetReadDeadline(timeoutDeadline(*idleTimeout))
+		if err := req.read(len(req.BufBuf)); err != nil {
+			return
+		}
+		c.SetReadDeadline(timeoutDeadline(*readTimeout))
+		if err := req.Parse(); err != nil {
+			logf("tls parse: %v", err)
+			return
+		}
+		c.SetWriteDeadline(timeoutDeadline(*readTimeout))
+		if !HTTPServeRequest(req) {
+			return
+		}
+	}
+}
+
+func timeoutDeadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func genCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"test"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(certFile, certPem, 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	pool = x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPem))
+	return
+}
+
+func startTLS(t *testing.T) (addr string, pool *x509.CertPool) {
+	dir, err := ioutil.TempDir("", "hlc-tls")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	certFile, keyFile, pool := genCert(t, dir)
+	cfg, err := LoadTLSConfig(certFile, keyFile)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go ServeTLS(ln, cfg)
+	return ln.Addr().String(), pool
+}
+
+func TestTLS_KeepAlive(t *testing.T) {
+	addr, pool := startTLS(t)
+
+	c, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool})
+	require.NoError(t, err)
+	defer c.Close()
+
+	rd := bufio.NewReader(c)
+	for i := 0; i < 3; i++ {
+		_, err = c.Write([]byte("GET /test HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(rd, nil)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, "{}", string(body))
+	}
+}
+
+func TestTLS_Untrusted(t *testing.T) {
+	addr, _ := startTLS(t)
+
+	_, err := tls.Dial("tcp", addr, &tls.Config{})
+	require.Error(t, err)
+}
+
+func TestLoadTLSConfig_Missing(t *testing.T) {
+	_, err := LoadTLSConfig("", "")
+	require.Error(t, err)
+	_, err = LoadTLSConfig("/nonexistent/cert.pem", "/nonexistent/key.pem")
+	require.Error(t, err)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"strconv"
+
+	bitmap "github.com/funny-falcon/highloadcup2018/bitmap3"
+)
+
+const (
+	TopLikes  = "likes"
+	TopLikers = "likers"
+	TopWindow = "window"
+)
+
+type topElem struct {
+	uid int32
+	cnt uint32
+}
+
+// topHeap is a min-heap of best accounts found so far.
+type topHeap []topElem
+
+func (h topHeap) less(i, j topElem) bool {
+	return i.cnt < j.cnt || i.cnt == j.cnt && i.uid < j.uid
+}
+
+func (h *topHeap) Add(limit int, el topElem) {
+	if len(*h) < limit {
+		*h = append(*h, el)
+		h.up(len(*h) - 1)
+	} else if h.less((*h)[0], el) {
+		(*h)[0] = el
+		h.down(0)
+	}
+}
+
+func (h topHeap) up(i int) {
+	for i > 0 {
+		p := (i - 1) / 2
+		if !h.less(h[i], h[p]) {
+			break
+		}
+		h[i], h[p] = h[p], h[i]
+		i = p
+	}
+}
+
+func (h topHeap) down(i int) {
+	l := len(h)
+	for i*2+1 < l {
+		c := i*2 + 1
+		if c+1 < l && h.less(h[c+1], h[c]) {
+			c++
+		}
+		if !h.less(h[c], h[i]) {
+			break
+		}
+		h[i], h[c] = h[c], h[i]
+		i = c
+	}
+}
+
+func (h *topHeap) Pop() topElem {
+	old := *h
+	el := old[0]
+	l := len(old) - 1
+	old[0] = old[l]
+	*h = old[:l]
+	h.down(0)
+	return el
+}
+
+// windowLikes counts likes received by uid with gt < ts < lt.
+func windowLikes(uid int32, gt, lt int32) uint32 {
+	likers := GetLikers(uid)
+	if likers == nil {
+		return 0
+	}
+	cnt := uint32(0)
+	for _, el := range likers.Data[:likers.Size] {
+		if el.Ts > gt && el.Ts < lt {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// doTop ranks accounts by popularity. Accounts are visited by buckets of
+// count index from the most popular, so only top buckets are usually
+// scanned. Window count never exceeds total likes count, so LikesCount
+// buckets bound it as well.
+func doTop(ctx *Request) {
+	q := newFilterQuery()
+	defer q.release()
+	limit := -1
+	metric := TopLikes
+	groupCity := false
+	tsGt := int32(-1 << 31)
+	tsLt := int32(1<<31 - 1)
+
+	for _, kv := range ctx.Args {
+		key, val := kv.k, kv.v
+		switch key {
+		case "limit":
+			var err error
+			limit, err = strconv.Atoi(val)
+			if err != nil || limit == 0 {
+				logf("limit: %s", err)
+				q.correct = false
+			}
+		case "metric":
+			switch val {
+			case TopLikes, TopLikers, TopWindow:
+				metric = val
+			default:
+				logf("metric incorrect")
+				q.correct = false
+			}
+		case "ts_gt", "ts_lt":
+			n, err := strconv.ParseInt(val, 10, 32)
+			if err != nil {
+				logf("%s incorrect", key)
+				q.correct = false
+				break
+			}
+			if key == "ts_gt" {
+				tsGt = int32(n)
+			} else {
+				tsLt = int32(n)
+			}
+		case "group":
+			if val != "city" {
+				logf("group incorrect")
+				q.correct = false
+			}
+			groupCity = true
+		case "query_id":
+			// ignore
+		default:
+			if !q.addArg(key, val) {
+				logf("default incorrect")
+				q.correct = false
+			}
+		}
+		if !q.correct {
+			break
+		}
+	}
+	q.finish()
+	if !q.correct || limit <= 0 {
+		ctx.SetStatusCode(400)
+		return
+	}
+	if q.emptyRes {
+		ctx.SetStatusCode(200)
+		if groupCity {
+			ctx.SetBody(EmptyGroupRes)
+		} else {
+			ctx.SetBody(EmptyFilterRes)
+		}
+		return
+	}
+
+	index := &LikesCount
+	if metric == TopLikers {
+		index = &LikersCount
+	}
+	count := func(uid int32) uint32 {
+		if metric == TopWindow {
+			return windowLikes(uid, tsGt, tsLt)
+		}
+		return index.Get(uid)
+	}
+	filter := combineFilters(q.filters)
+	maps := append(q.maps, &AccountsMap)
+
+	if groupCity {
+		doTopCities(ctx, limit, maps, filter, count)
+		return
+	}
+
+	var heap topHeap
+	for b := CountBucket(^uint32(0)); b >= 0; b-- {
+		if len(heap) == limit {
+			// next buckets couldn't beat worst found account
+			if _, hi := BucketBounds(b); heap[0].cnt > hi {
+				break
+			}
+		}
+		bitmap.Loop(bitmap.NewAndBitmap(append(maps, &index.Buckets[b])), func(uids []int32) bool {
+			for _, uid := range uids {
+				if filter != nil && !filter(uid, RefAccount(uid)) {
+					continue
+				}
+				heap.Add(limit, topElem{uid, count(uid)})
+			}
+			return true
+		})
+	}
+
+	res := make([]topElem, len(heap))
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = heap.Pop()
+	}
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"accounts":[`))
+	for i, el := range res {
+		outAccountFields(&q.outFields, RefAccount(el.uid), stream)
+		stream.Write([]byte(`,"count":`))
+		stream.WriteUint32(el.cnt)
+		stream.WriteObjectEnd()
+		if i != len(res)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
+
+// doTopCities sums popularity of filtered accounts by city.
+func doTopCities(ctx *Request, limit int, maps []bitmap.IBitmap,
+	filter func(int32, *Account) bool, count func(int32) uint32) {
+	groups := make([]groupCounter, len(CityStrings.Arr)+1)
+	for i := range groups {
+		groups[i].u = uint32(i)
+	}
+	bitmap.Loop(bitmap.NewAndBitmap(maps), func(uids []int32) bool {
+		for _, uid := range uids {
+			acc := RefAccount(uid)
+			// city inserted concurrently is not counted
+			if int(acc.City) >= len(groups) || filter != nil && !filter(uid, acc) {
+				continue
+			}
+			groups[acc.City].s += count(uid)
+		}
+		return true
+	})
+	groups = SortGroupLimit(limit, -1, groups, func(idi, idj uint32) bool {
+		return CityStrings.GetStr(idi) > CityStrings.GetStr(idj)
+	})
+
+	ctx.SetStatusCode(200)
+	stream := jsonConfig.BorrowStream(nil)
+	stream.Write([]byte(`{"groups":[`))
+	for i, gr := range groups {
+		stream.WriteObjectStart()
+		if gr.u != 0 {
+			stream.Write([]byte(`"city":`))
+			stream.WriteString(CityStrings.GetStr(gr.u))
+			stream.WriteMore()
+		}
+		stream.Write([]byte(`"count":`))
+		stream.WriteUint32(gr.s)
+		stream.WriteObjectEnd()
+		if i != len(groups)-1 {
+			stream.WriteMore()
+		}
+	}
+	stream.Write([]byte(`]}`))
+	ctx.SetBody(stream.Buffer())
+	jsonConfig.ReturnStream(stream)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type topAccount struct {
+	Id    int32  `json:"id"`
+	Count uint32 `json:"count"`
+}
+
+type topCity struct {
+	City  string `json:"city"`
+	Count uint32 `json:"count"`
+}
+
+// bruteTopCount counts likes received by uid by scanning likers of all
+// accounts: events, distinct likers or events in window.
+func bruteTopCount(uid int32, metric string, gt, lt int32) uint32 {
+	likers := GetLikers(uid)
+	if likers == nil {
+		return 0
+	}
+	cnt := uint32(0)
+	for i, el := range likers.Data[:likers.Size] {
+		switch metric {
+		case TopLikes:
+			cnt++
+		case TopLikers:
+			if i == 0 || likers.Data[i-1].Uid != el.Uid {
+				cnt++
+			}
+		case TopWindow:
+			if el.Ts > gt && el.Ts < lt {
+				cnt++
+			}
+		}
+	}
+	return cnt
+}
+
+type topCase struct {
+	args  string
+	match func(*Account) bool
+}
+
+func topCases() []topCase {
+	all := func(*Account) bool { return true }
+	return []topCase{
+		{"", all},
+		{"sex_eq=m", func(acc *Account) bool { return acc.Sex }},
+		{"status_eq=" + StatusComplex, func(acc *Account) bool { return acc.Status == StatusComplexIx }},
+		{"country_eq=Франция", func(acc *Account) bool {
+			return uint32(acc.Country) == CountryStrings.Find("Франция")
+		}},
+	}
+}
+
+func topArgs(tc topCase, metric string, gt, lt int32, limit int) string {
+	args := escapeArgs(tc.args)
+	if args != "" {
+		args += "&"
+	}
+	args += fmt.Sprintf("metric=%s&limit=%d", metric, limit)
+	if metric == TopWindow {
+		args += fmt.Sprintf("&ts_gt=%d&ts_lt=%d", gt, lt)
+	}
+	return args
+}
+
+func serveTop(t *testing.T, args string, res interface{}) {
+	code, body := serve(t, "GET", "/accounts/top/?"+args, "")
+	require.Equal(t, 200, code, "%s: %s", args, body)
+	require.NoError(t, json.Unmarshal([]byte(body), res), body)
+}
+
+func TestTop(t *testing.T) {
+	loadFixture(t)
+
+	// counts at bucket bounds for accounts without fixture likes: first and
+	// last tie at the upper bound of 16..31 bucket, so top-2 must look past
+	// the bucket to order them by uid
+	var popular []int32
+	for uid := int32(1000); len(popular) < 5; uid++ {
+		if bruteTopCount(uid, TopLikes, 0, 0) == 0 {
+			popular = append(popular, uid)
+		}
+	}
+	for i, n := range []int{31, 32, 16, 15, 31} {
+		likes := make([]string, n)
+		for j := range likes {
+			// the last like repeats liker, so likers count differs
+			liker := 2000 + j
+			if j == n-1 {
+				liker = 2000
+			}
+			likes[j] = fmt.Sprintf(`{"likee":%d,"liker":%d,"ts":%d}`, popular[i], liker, 1500000000+j*10)
+		}
+		code, body := serve(t, "POST", "/accounts/likes/", `{"likes":[`+strings.Join(likes, ",")+`]}`)
+		require.Equal(t, 202, code, body)
+	}
+
+	windows := [][2]int32{{1500000050, 1500000200}, {1400000000, 1600000000}}
+	for _, tc := range topCases() {
+		for _, metric := range []string{TopLikes, TopLikers, TopWindow} {
+			for _, w := range windows {
+				var all []topAccount
+				for uid := int32(1); uid < MaxId; uid++ {
+					if acc := HasAccount(uid); acc != nil && tc.match(acc) {
+						all = append(all, topAccount{uid, bruteTopCount(uid, metric, w[0], w[1])})
+					}
+				}
+				sort.Slice(all, func(i, j int) bool {
+					if all[i].Count != all[j].Count {
+						return all[i].Count > all[j].Count
+					}
+					return all[i].Id > all[j].Id
+				})
+				for _, limit := range []int{1, 2, 3, 4, 5, 17, 50} {
+					args := topArgs(tc, metric, w[0], w[1], limit)
+					var res struct {
+						Accounts []topAccount `json:"accounts"`
+					}
+					serveTop(t, args, &res)
+					want := all
+					if len(want) > limit {
+						want = want[:limit]
+					}
+					require.Equal(t, want, res.Accounts, args)
+				}
+				if metric != TopWindow {
+					break
+				}
+			}
+		}
+	}
+
+	var res struct {
+		Accounts []topAccount `json:"accounts"`
+	}
+	serveTop(t, "limit=2", &res)
+	require.Equal(t, []topAccount{{popular[1], 32}, {popular[4], 31}}, res.Accounts)
+	serveTop(t, "limit=2&metric=likers", &res)
+	require.Equal(t, []topAccount{{popular[1], 31}, {popular[4], 30}}, res.Accounts)
+}
+
+func TestTopCities(t *testing.T) {
+	loadFixture(t)
+
+	for _, tc := range topCases() {
+		for _, metric := range []string{TopLikes, TopLikers, TopWindow} {
+			gt, lt := int32(1500000100), int32(1500000800)
+			sums := map[string]uint32{}
+			for uid := int32(1); uid < MaxId; uid++ {
+				if acc := HasAccount(uid); acc != nil && tc.match(acc) {
+					sums[CityStrings.GetStr(uint32(acc.City))] += bruteTopCount(uid, metric, gt, lt)
+				}
+			}
+			var all []topCity
+			for city, cnt := range sums {
+				if cnt > 0 {
+					all = append(all, topCity{city, cnt})
+				}
+			}
+			sort.Slice(all, func(i, j int) bool {
+				if all[i].Count != all[j].Count {
+					return all[i].Count > all[j].Count
+				}
+				return all[i].City < all[j].City
+			})
+			for _, limit := range []int{1, 3, 10} {
+				args := topArgs(tc, metric, gt, lt, limit) + "&group=city"
+				var res struct {
+					Groups []topCity `json:"groups"`
+				}
+				serveTop(t, args, &res)
+				want := all
+				if len(want) > limit {
+					want = want[:limit]
+				}
+				require.Equal(t, want, res.Groups, args)
+			}
+		}
+	}
+}
+
+func TestTopIncorrect(t *testing.T) {
+	loadFixture(t)
+	for _, args := range []string{
+		"",
+		"limit=0",
+		"limit=5&metric=views",
+		"limit=5&ts_gt=abc",
+		"limit=5&group=country",
+		"limit=5&unknown=1",
+		"limit=5&sex_eq=x",
+	} {
+		code, _ := serve(t, "GET", "/accounts/top/?"+args, "")
+		require.Equal(t, 400, code, args)
+	}
+	code, body := serve(t, "GET", "/accounts/top/?limit=5&city_eq=Атлантида&group=city", "")
+	require.Equal(t, 200, code)
+	require.JSONEq(t, `{"groups":[]}`, body)
+}